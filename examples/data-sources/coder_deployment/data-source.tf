@@ -0,0 +1,24 @@
+data "coder_deployment" "me" {
+  # code-server must be served from the root of a domain.
+  require_subdomain_apps = true
+}
+
+data "coder_workspace" "me" {}
+data "coder_workspace_owner" "me" {}
+
+resource "coder_agent" "dev" {
+  os   = "linux"
+  arch = "amd64"
+  env = {
+    CODE_SERVER_URL = replace(replace(replace(replace(data.coder_deployment.me.subdomain_app_url_template,
+      "{app}", "code-server"), "{agent}", "dev"),
+      "{workspace}", data.coder_workspace.me.name), "{owner}", data.coder_workspace_owner.me.name)
+  }
+}
+
+resource "coder_app" "code-server" {
+  agent_id  = coder_agent.dev.id
+  slug      = "code-server"
+  url       = "http://localhost:13337"
+  subdomain = true
+}
@@ -0,0 +1,13 @@
+data "coder_icons" "builtin" {}
+
+resource "coder_agent" "dev" {
+  os   = "linux"
+  arch = "amd64"
+}
+
+resource "coder_app" "jupyter" {
+  agent_id = coder_agent.dev.id
+  slug     = "jupyter"
+  icon     = data.coder_icons.builtin.icons["jupyter"]
+  url      = "http://localhost:8888"
+}
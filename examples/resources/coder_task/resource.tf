@@ -0,0 +1,41 @@
+data "coder_parameter" "prompt" {
+  name         = "AI Prompt"
+  display_name = "Prompt"
+  description  = "What should the agent work on?"
+  form_type    = "textarea"
+  mutable      = false
+  default      = ""
+}
+
+resource "coder_agent" "dev" {
+  os   = "linux"
+  arch = "amd64"
+}
+
+resource "coder_app" "agent" {
+  agent_id     = coder_agent.dev.id
+  slug         = "agent"
+  display_name = "AI Agent"
+  url          = "http://localhost:3284"
+}
+
+resource "coder_task" "agent" {
+  agent_id         = coder_agent.dev.id
+  app_slug         = coder_app.agent.slug
+  prompt_parameter = data.coder_parameter.prompt.name
+}
+
+# Pass the prompt and the status slug to the process running the task.
+resource "coder_env" "task_prompt" {
+  agent_id            = coder_agent.dev.id
+  name                = "CODER_TASK_PROMPT"
+  value               = coder_task.agent.env["CODER_TASK_PROMPT"]
+  allow_reserved_name = true
+}
+
+resource "coder_env" "task_status_slug" {
+  agent_id            = coder_agent.dev.id
+  name                = "CODER_MCP_APP_STATUS_SLUG"
+  value               = coder_task.agent.env["CODER_MCP_APP_STATUS_SLUG"]
+  allow_reserved_name = true
+}
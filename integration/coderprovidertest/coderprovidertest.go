@@ -0,0 +1,778 @@
+// Package coderprovidertest runs templates against an ephemeral Coder
+// deployment in Docker, so template authors can test their templates with
+// the real provider in CI:
+//
+//	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+//		ProviderDir:  "/path/to/dir/with/terraform-provider-coder",
+//		TemplatesDir: "./templates",
+//	})
+//	deployment.PushTemplate(ctx, "docker", map[string]string{"output_path": "/tmp/docker.json"})
+//	deployment.CreateWorkspace(ctx, "docker", "docker")
+//	coderprovidertest.AssertOutput(t, map[string]string{"workspace.name": `docker`},
+//		deployment.ReadJSON(ctx, "/tmp/docker.json"))
+//
+// All interfaces to the deployment go through the Coder CLI inside the
+// container rather than github.com/coder/coder/v2/codersdk, to avoid a
+// circular dependency on the provider.
+package coderprovidertest
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// URL is the access URL of the deployment inside its container.
+	URL = "http://localhost:3000"
+
+	// nolint:gosec // For testing only.
+	Email    = "testing@coder.com"
+	Password = "InsecurePassw0rd!"
+	Username = "testing"
+
+	// providerPath and templatesPath are where the provider and templates
+	// are mounted in the container.
+	providerPath  = "/provider"
+	templatesPath = "/templates"
+)
+
+// Options configures the deployment started by New.
+type Options struct {
+	// Image is the Coder image to run. Defaults to $CODER_IMAGE, or
+	// "ghcr.io/coder/coder".
+	Image string
+	// Version is the tag of Image to run. Defaults to $CODER_VERSION, or
+	// "latest".
+	Version string
+	// Platform is the platform of the image to run, such as "linux/arm64".
+	// Defaults to $CODER_PLATFORM, or Linux on the architecture of the
+	// host, so the deployment runs natively rather than under emulation.
+	Platform string
+	// ProviderDir is the directory containing the terraform-provider-coder
+	// binary templates are run with. It must be built for the architecture
+	// of Platform, on Linux.
+	ProviderDir string
+	// TemplatesDir is the directory containing a directory for each
+	// template, named after the template.
+	TemplatesDir string
+	// Env is added to the environment of the deployment, such as
+	// CODER_EXTERNAL_AUTH_* variables.
+	Env []string
+	// Network is the Docker network to run the deployment on, so it can
+	// reach sidecars. See NewNetwork.
+	Network string
+	// License is an enterprise license to add to the deployment once it's
+	// set up. Defaults to $CODER_LICENSE, or none.
+	License string
+	// RemoteURL and SessionToken select an existing deployment to run
+	// templates against instead of starting one in Docker, such as a
+	// staging deployment. Templates then run with the provider installed on
+	// its provisioners, rather than the one in ProviderDir, and commands run
+	// on the host with the coder CLI. Default to $CODER_URL and
+	// $CODER_SESSION_TOKEN.
+	RemoteURL    string
+	SessionToken string
+	// ArtifactsDir is where the server log, and the logs of template version
+	// and workspace build jobs, are written when the test fails, in a
+	// directory named after the test. Defaults to $CODER_TEST_ARTIFACTS, or
+	// "artifacts".
+	ArtifactsDir string
+	// ReadyTimeout is how long to wait for the deployment to start.
+	// Defaults to 10 seconds.
+	ReadyTimeout time.Duration
+}
+
+// Deployment is an ephemeral Coder deployment running in Docker, logged in
+// as the first user.
+type Deployment struct {
+	t           testing.TB
+	ContainerID string
+	// Arch is the architecture the deployment runs on, and so the
+	// architecture reported by the "coder_provisioner" data source. It's
+	// empty for remote deployments.
+	Arch string
+	// Remote is whether the deployment is an existing one given by
+	// Options.RemoteURL, rather than a container. Files written by templates
+	// can't be read back from remote deployments.
+	Remote bool
+
+	templatesDir string
+	env          []string
+	// workspaces and templates are created on remote deployments, to delete
+	// them when the test finishes.
+	workspaces []string
+	templates  []string
+}
+
+// New starts a Coder deployment that runs templates with the provider in
+// opts.ProviderDir. The container is removed when the test finishes.
+//
+// If opts.RemoteURL is set, it uses that deployment instead, and deletes
+// the workspaces and templates it creates when the test finishes.
+func New(ctx context.Context, t testing.TB, opts Options) *Deployment {
+	t.Helper()
+	if opts.RemoteURL == "" {
+		opts.RemoteURL = os.Getenv("CODER_URL")
+	}
+	if opts.SessionToken == "" {
+		opts.SessionToken = os.Getenv("CODER_SESSION_TOKEN")
+	}
+	if opts.ArtifactsDir == "" {
+		opts.ArtifactsDir = os.Getenv("CODER_TEST_ARTIFACTS")
+	}
+	if opts.ArtifactsDir == "" {
+		opts.ArtifactsDir = "artifacts"
+	}
+	if opts.RemoteURL != "" {
+		return newRemote(ctx, t, opts)
+	}
+
+	// For this to work, we pass in a custom terraformrc to use the locally
+	// built version of the provider.
+	testTerraformrc := fmt.Sprintf(`provider_installation {
+		dev_overrides {
+		  "coder/coder" = %q
+		}
+		  direct{}
+	  }`, providerPath)
+
+	if opts.Image == "" {
+		opts.Image = os.Getenv("CODER_IMAGE")
+	}
+	if opts.Image == "" {
+		opts.Image = "ghcr.io/coder/coder"
+	}
+	if opts.Version == "" {
+		opts.Version = os.Getenv("CODER_VERSION")
+	}
+	if opts.Version == "" {
+		opts.Version = "latest"
+	}
+	if opts.Platform == "" {
+		opts.Platform = os.Getenv("CODER_PLATFORM")
+	}
+	if opts.Platform == "" {
+		opts.Platform = "linux/" + runtime.GOARCH
+	}
+	platform, err := parsePlatform(opts.Platform)
+	require.NoError(t, err, "invalid platform")
+	if opts.License == "" {
+		opts.License = os.Getenv("CODER_LICENSE")
+	}
+	if opts.License != "" {
+		// Pass the license through the environment so it isn't logged with
+		// the command that adds it.
+		opts.Env = append(opts.Env, "CODER_TEST_LICENSE="+opts.License)
+	}
+	if opts.ReadyTimeout == 0 {
+		opts.ReadyTimeout = 10 * time.Second
+	}
+	t.Logf("using coder image %s:%s for %s", opts.Image, opts.Version, opts.Platform)
+
+	providerDir, err := filepath.Abs(opts.ProviderDir)
+	require.NoError(t, err, "get abs path of provider dir")
+	binPath := filepath.Join(providerDir, "terraform-provider-coder")
+	if _, err := os.Stat(binPath); os.IsNotExist(err) {
+		t.Fatalf("not found: %q - please build the provider first", binPath)
+	}
+	requireBinaryPlatform(t, binPath, platform)
+	templatesDir, err := filepath.Abs(opts.TemplatesDir)
+	require.NoError(t, err, "get abs path of templates dir")
+
+	tmpDir := t.TempDir()
+	// Create a terraformrc to point to our freshly built provider!
+	tfrcPath := filepath.Join(tmpDir, "integration.tfrc")
+	err = os.WriteFile(tfrcPath, []byte(testTerraformrc), 0o644)
+	require.NoError(t, err, "write terraformrc to tempdir")
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err, "init docker client")
+	defer cli.Close()
+
+	// Stand up a temporary Coder instance
+	ctr, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: opts.Image + ":" + opts.Version,
+		Env: append([]string{
+			"CODER_ACCESS_URL=" + URL,                  // Set explicitly to avoid creating try.coder.app URLs.
+			"CODER_IN_MEMORY=true",                     // We don't necessarily care about real persistence here.
+			"CODER_TELEMETRY_ENABLE=false",             // Avoid creating noise.
+			"TF_CLI_CONFIG_FILE=/tmp/integration.tfrc", // Our custom tfrc from above.
+		}, opts.Env...),
+		Labels: map[string]string{},
+	}, &container.HostConfig{
+		Binds: []string{
+			tfrcPath + ":/tmp/integration.tfrc", // Custom tfrc from above.
+			providerDir + ":" + providerPath,    // The built provider.
+			templatesDir + ":" + templatesPath,  // The templates to push.
+		},
+		NetworkMode: container.NetworkMode(opts.Network),
+	}, nil, platform, "")
+	require.NoError(t, err, "create test deployment")
+
+	t.Logf("created container %s\n", ctr.ID)
+	t.Cleanup(func() { // Make sure we clean up after ourselves.
+		// TODO: also have this execute if you Ctrl+C!
+		t.Logf("stopping container %s\n", ctr.ID)
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			t.Logf("connect to docker: %s", err)
+			return
+		}
+		defer cli.Close()
+		_ = cli.ContainerRemove(context.Background(), ctr.ID, container.RemoveOptions{
+			Force: true,
+		})
+	})
+
+	err = cli.ContainerStart(ctx, ctr.ID, container.StartOptions{})
+	require.NoError(t, err, "start container")
+	t.Logf("started container %s\n", ctr.ID)
+
+	d := &Deployment{t: t, ContainerID: ctr.ID, Arch: platform.Architecture, templatesDir: templatesPath}
+	// Cleanups run in reverse, so this runs before the container is removed.
+	d.writeArtifactsOnFailure(opts.ArtifactsDir)
+	// Wait for container to come up
+	require.Eventually(t, func() bool {
+		_, rc := d.Exec(ctx, fmt.Sprintf(`curl -s --fail %s/api/v2/buildinfo`, URL))
+		if rc == 0 {
+			return true
+		}
+		t.Logf("not ready yet...")
+		return false
+	}, opts.ReadyTimeout, time.Second, "coder failed to become ready in time")
+
+	// Perform first time setup
+	_, rc := d.Exec(ctx, fmt.Sprintf(`coder login %s --first-user-email=%q --first-user-password=%q --first-user-trial=false --first-user-username=%q`, URL, Email, Password, Username))
+	require.Equal(t, 0, rc, "failed to perform first-time setup")
+	if opts.License != "" {
+		_, rc = d.Exec(ctx, `coder licenses add --license "$CODER_TEST_LICENSE"`)
+		require.Equal(t, 0, rc, "failed to add license")
+	}
+	return d
+}
+
+// newRemote returns the existing deployment at opts.RemoteURL.
+func newRemote(ctx context.Context, t testing.TB, opts Options) *Deployment {
+	t.Helper()
+	require.NotEmpty(t, opts.SessionToken, "a session token is required for remote deployment %s", opts.RemoteURL)
+	_, err := exec.LookPath("coder")
+	require.NoError(t, err, "the coder CLI is required for remote deployments")
+	templatesDir, err := filepath.Abs(opts.TemplatesDir)
+	require.NoError(t, err, "get abs path of templates dir")
+	t.Logf("using remote deployment %s", opts.RemoteURL)
+
+	d := &Deployment{
+		t:            t,
+		Remote:       true,
+		templatesDir: templatesDir,
+		// The coder CLI reads these too.
+		env: []string{
+			"CODER_URL=" + opts.RemoteURL,
+			"CODER_SESSION_TOKEN=" + opts.SessionToken,
+		},
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		for i := len(d.workspaces) - 1; i >= 0; i-- {
+			d.Exec(ctx, fmt.Sprintf(`coder delete %s --yes`, shellQuote(d.workspaces[i])))
+		}
+		for i := len(d.templates) - 1; i >= 0; i-- {
+			d.Exec(ctx, fmt.Sprintf(`coder templates delete %s --yes`, shellQuote(d.templates[i])))
+		}
+	})
+	d.writeArtifactsOnFailure(opts.ArtifactsDir)
+
+	_, rc := d.Exec(ctx, `coder whoami`)
+	require.Equal(t, 0, rc, "failed to authenticate with %s", opts.RemoteURL)
+	return d
+}
+
+// parsePlatform parses a platform such as "linux/arm64" or
+// "linux/arm64/v8".
+func parsePlatform(s string) (*ocispec.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("platform %q must be in the form os/arch[/variant]", s)
+	}
+	platform := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// elfMachines maps Go architectures to the machine of ELF binaries built for
+// them.
+var elfMachines = map[string]elf.Machine{
+	"386":   elf.EM_386,
+	"amd64": elf.EM_X86_64,
+	"arm":   elf.EM_ARM,
+	"arm64": elf.EM_AARCH64,
+}
+
+// requireBinaryPlatform fails the test unless the binary at path can run on
+// platform, as a mismatched provider only fails once a template is pushed,
+// with an unhelpful error.
+func requireBinaryPlatform(t testing.TB, path string, platform *ocispec.Platform) {
+	t.Helper()
+	build := fmt.Sprintf("build it with GOOS=%s GOARCH=%s CGO_ENABLED=0 go build .", platform.OS, platform.Architecture)
+	bin, err := elf.Open(path)
+	if err != nil {
+		t.Fatalf("%q is not a Linux binary - %s", path, build)
+	}
+	defer bin.Close()
+	if machine, ok := elfMachines[platform.Architecture]; ok && bin.Machine != machine {
+		t.Fatalf("%q is built for %s, not %s - %s", path, bin.Machine, platform.Architecture, build)
+	}
+}
+
+// PushTemplate pushes the template in the directory of TemplatesDir named
+// name, with the given variables.
+func (d *Deployment) PushTemplate(ctx context.Context, name string, vars map[string]string) {
+	d.t.Helper()
+	varNames := make([]string, 0, len(vars))
+	for varName := range vars {
+		varNames = append(varNames, varName)
+	}
+	sort.Strings(varNames)
+	var flags strings.Builder
+	for _, varName := range varNames {
+		fmt.Fprintf(&flags, " --var %s", shellQuote(varName+"="+vars[varName]))
+	}
+	_, rc := d.Exec(ctx, fmt.Sprintf(`coder templates push %s --directory %s%s --yes`, shellQuote(name), shellQuote(filepath.Join(d.templatesDir, name)), flags.String()))
+	require.Equal(d.t, 0, rc, "push template %q", name)
+	if d.Remote && !contains(d.templates, name) {
+		d.templates = append(d.templates, name)
+	}
+}
+
+// CreateWorkspace creates a workspace named name from template, and waits
+// for its build to complete. Parameters use their defaults.
+func (d *Deployment) CreateWorkspace(ctx context.Context, name, template string) {
+	d.t.Helper()
+	d.CreateWorkspaceWithParameters(ctx, name, template, nil)
+}
+
+// CreateWorkspaceWithParameters is like CreateWorkspace, but sets the given
+// parameters by name.
+func (d *Deployment) CreateWorkspaceWithParameters(ctx context.Context, name, template string, params map[string]string) {
+	d.t.Helper()
+	paramNames := make([]string, 0, len(params))
+	for paramName := range params {
+		paramNames = append(paramNames, paramName)
+	}
+	sort.Strings(paramNames)
+	var flags strings.Builder
+	for _, paramName := range paramNames {
+		fmt.Fprintf(&flags, " --parameter %s", shellQuote(paramName+"="+params[paramName]))
+	}
+	_, rc := d.Exec(ctx, fmt.Sprintf(`coder create %s -t %s%s --yes`, shellQuote(name), shellQuote(template), flags.String()))
+	require.Equal(d.t, 0, rc, "create workspace %q", name)
+	if d.Remote {
+		d.workspaces = append(d.workspaces, name)
+	}
+}
+
+// ReadJSON reads a JSON object of strings from path in the container, such
+// as a local_file written by a template.
+func (d *Deployment) ReadJSON(ctx context.Context, path string) map[string]string {
+	d.t.Helper()
+	require.False(d.t, d.Remote, "files written by templates can't be read from remote deployments")
+	out, rc := d.Exec(ctx, fmt.Sprintf(`cat %s`, shellQuote(path)))
+	require.Equal(d.t, 0, rc, "read %q", path)
+	actual := make(map[string]string)
+	require.NoError(d.t, json.NewDecoder(strings.NewReader(out)).Decode(&actual))
+	return actual
+}
+
+// UpgradeChanges applies the template in the directory of TemplatesDir named
+// name with the given released version of the provider, then plans it again
+// with the provider in ProviderDir. It returns the destructive changes in
+// that plan, formatted as "<address>: <actions>", so an empty result means
+// upgrading the provider doesn't replace any resources of existing
+// workspaces. An empty version uses the latest release.
+//
+// Terraform is run directly in the container, rather than through a
+// workspace build, as the provisioner always uses the provider in
+// ProviderDir.
+func (d *Deployment) UpgradeChanges(ctx context.Context, name, version string, vars map[string]string) []string {
+	d.t.Helper()
+	require.False(d.t, d.Remote, "upgrades can't be tested on remote deployments")
+	dir := "/tmp/upgrade-" + name
+	_, rc := d.Exec(ctx, fmt.Sprintf(`rm -rf %[1]s && cp -r %[2]s %[1]s && rm -rf %[1]s/.terraform %[1]s/.terraform.lock.hcl`, shellQuote(dir), shellQuote(templatesPath+"/"+name)))
+	require.Equal(d.t, 0, rc, "copy template %q", name)
+	if version != "" {
+		override := fmt.Sprintf(`terraform {
+  required_providers {
+    coder = {
+      source  = "coder/coder"
+      version = %q
+    }
+  }
+}
+`, "= "+version)
+		_, rc = d.Exec(ctx, fmt.Sprintf(`printf '%%s' %s > %s`, shellQuote(override), shellQuote(dir+"/upgrade_override.tf")))
+		require.Equal(d.t, 0, rc, "pin provider version")
+	}
+
+	varNames := make([]string, 0, len(vars))
+	for varName := range vars {
+		varNames = append(varNames, varName)
+	}
+	sort.Strings(varNames)
+	var flags strings.Builder
+	for _, varName := range varNames {
+		fmt.Fprintf(&flags, " -var %s", shellQuote(varName+"="+vars[varName]))
+	}
+
+	// An empty CLI config installs providers from the registry, ignoring the
+	// dev_overrides in TF_CLI_CONFIG_FILE.
+	_, rc = d.Exec(ctx, fmt.Sprintf(`cd %s && export TF_CLI_CONFIG_FILE=/dev/null && terraform init -input=false -no-color && terraform apply -input=false -no-color -auto-approve%s`, shellQuote(dir), flags.String()))
+	require.Equal(d.t, 0, rc, "apply template %q with the released provider", name)
+
+	_, rc = d.Exec(ctx, fmt.Sprintf(`cd %s && rm -f upgrade_override.tf && terraform plan -input=false -no-color -out=upgrade.tfplan%s`, shellQuote(dir), flags.String()))
+	require.Equal(d.t, 0, rc, "plan template %q with the local provider", name)
+	out, rc := d.Exec(ctx, fmt.Sprintf(`cd %s && terraform show -json upgrade.tfplan`, shellQuote(dir)))
+	require.Equal(d.t, 0, rc, "show plan of template %q", name)
+
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	require.NoError(d.t, json.Unmarshal([]byte(out), &plan), "decode plan")
+	var changes []string
+	for _, change := range plan.ResourceChanges {
+		for _, action := range change.Change.Actions {
+			if action == "delete" {
+				changes = append(changes, change.Address+": "+strings.Join(change.Change.Actions, ", "))
+				break
+			}
+		}
+	}
+	return changes
+}
+
+// LinkExternalAuth links the logged in user with the external auth provider
+// id by following its OAuth2 flow, as a browser would. The provider must
+// authorize without a login form, as fake OAuth2 providers do.
+func (d *Deployment) LinkExternalAuth(ctx context.Context, id string) {
+	d.t.Helper()
+	require.False(d.t, d.Remote, "external auth can't be linked on remote deployments")
+	jar := "/tmp/external-auth-" + id + ".cookies"
+	_, rc := d.Exec(ctx, fmt.Sprintf(`curl -s --fail -L -c %[1]s -b %[1]s -b "coder_session_token=$(cat "${CODER_CONFIG_DIR:-$HOME/.config/coderv2}/session")" %[2]s`, shellQuote(jar), shellQuote(URL+"/external-auth/"+id+"/callback")))
+	require.Equal(d.t, 0, rc, "follow OAuth2 flow of external auth %q", id)
+
+	out, rc := d.Exec(ctx, d.apiCommand("/api/v2/external-auth/"+id))
+	require.Equal(d.t, 0, rc, "get external auth %q", id)
+	var auth struct {
+		Authenticated bool `json:"authenticated"`
+	}
+	require.NoError(d.t, json.Unmarshal([]byte(out), &auth), "decode external auth")
+	require.True(d.t, auth.Authenticated, "external auth %q is not linked", id)
+}
+
+// Workspace is the subset of a workspace in the Coder API needed to make
+// assertions about its agents.
+type Workspace struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	LatestBuild struct {
+		Transition string `json:"transition"`
+		Status     string `json:"status"`
+		Resources  []struct {
+			Name   string  `json:"name"`
+			Agents []Agent `json:"agents"`
+		} `json:"resources"`
+	} `json:"latest_build"`
+}
+
+// Agents returns the agents of all resources of the latest build.
+func (w Workspace) Agents() []Agent {
+	var agents []Agent
+	for _, resource := range w.LatestBuild.Resources {
+		agents = append(agents, resource.Agents...)
+	}
+	return agents
+}
+
+// Agent is the subset of a workspace agent in the Coder API.
+type Agent struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	LifecycleState string `json:"lifecycle_state"`
+	Apps           []struct {
+		Slug         string `json:"slug"`
+		Health       string `json:"health"`
+		SharingLevel string `json:"sharing_level"`
+	} `json:"apps"`
+}
+
+// Workspace returns the workspace named name, owned by the first user.
+func (d *Deployment) Workspace(ctx context.Context, name string) Workspace {
+	d.t.Helper()
+	out, rc := d.Exec(ctx, `coder list --output json`)
+	require.Equal(d.t, 0, rc, "list workspaces")
+	var workspaces []Workspace
+	require.NoError(d.t, json.Unmarshal([]byte(out), &workspaces), "decode workspaces")
+	for _, workspace := range workspaces {
+		if workspace.Name == name {
+			return workspace
+		}
+	}
+	d.t.Fatalf("workspace %q not found", name)
+	return Workspace{}
+}
+
+// AgentLogs returns the output of the startup logs of the agent, such as the
+// output of its scripts, one line per log.
+func (d *Deployment) AgentLogs(ctx context.Context, agentID string) string {
+	d.t.Helper()
+	out, rc := d.Exec(ctx, d.apiCommand("/api/v2/workspaceagents/"+agentID+"/logs"))
+	require.Equal(d.t, 0, rc, "get agent logs")
+	var logs []struct {
+		Output string `json:"output"`
+	}
+	require.NoError(d.t, json.Unmarshal([]byte(out), &logs), "decode agent logs")
+	lines := make([]string, 0, len(logs))
+	for _, log := range logs {
+		lines = append(lines, log.Output)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// apiCommand returns a command that gets apiPath from the API of the
+// deployment as the logged in user.
+func (d *Deployment) apiCommand(apiPath string) string {
+	if d.Remote {
+		return fmt.Sprintf(`curl -s --fail -H "Coder-Session-Token: $CODER_SESSION_TOKEN" "$CODER_URL"%s`, shellQuote(apiPath))
+	}
+	return fmt.Sprintf(`curl -s --fail -H "Coder-Session-Token: $(cat "${CODER_CONFIG_DIR:-$HOME/.config/coderv2}/session")" %s`, shellQuote(URL+apiPath))
+}
+
+// Exec executes the given command in the container of the deployment, or on
+// the host for remote deployments, and returns the output and the exit code
+// of the command.
+func (d *Deployment) Exec(ctx context.Context, command string) (string, int) {
+	d.t.Helper()
+	d.t.Logf("exec container cmd: %q", command)
+	out, rc, err := d.exec(ctx, command)
+	require.NoError(d.t, err)
+	d.t.Log("exec container output:\n" + out)
+	return out, rc
+}
+
+func (d *Deployment) exec(ctx context.Context, command string) (string, int, error) {
+	if d.Remote {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+		cmd.Env = append(os.Environ(), d.env...)
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode(), nil
+		}
+		return string(out), 0, err
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", 0, fmt.Errorf("connect to docker: %w", err)
+	}
+	defer cli.Close()
+	execConfig := types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          []string{"/bin/sh", "-c", command},
+	}
+	ex, err := cli.ContainerExecCreate(ctx, d.ContainerID, execConfig)
+	if err != nil {
+		return "", 0, fmt.Errorf("create container exec: %w", err)
+	}
+	resp, err := cli.ContainerExecAttach(ctx, ex.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", 0, fmt.Errorf("attach to container exec: %w", err)
+	}
+	defer resp.Close()
+	var buf bytes.Buffer
+	_, err = stdcopy.StdCopy(&buf, &buf, resp.Reader)
+	if err != nil {
+		return "", 0, fmt.Errorf("read stdout: %w", err)
+	}
+	execResp, err := cli.ContainerExecInspect(ctx, ex.ID)
+	if err != nil {
+		return "", 0, fmt.Errorf("get exec exit code: %w", err)
+	}
+	return buf.String(), execResp.ExitCode, nil
+}
+
+// writeArtifactsOnFailure writes artifacts to a directory of dir named after
+// the test when it finishes, if it failed.
+func (d *Deployment) writeArtifactsOnFailure(dir string) {
+	d.t.Cleanup(func() {
+		if !d.t.Failed() {
+			return
+		}
+		dir := filepath.Join(dir, artifactsName(d.t.Name()))
+		if err := d.writeArtifacts(dir); err != nil {
+			d.t.Logf("write artifacts: %s", err)
+			return
+		}
+		d.t.Logf("wrote artifacts to %s", dir)
+	})
+}
+
+// writeArtifacts writes the server log, and the logs of the jobs of the
+// active version of each template and the latest build of each workspace,
+// to dir. It's best effort: logs that can't be fetched are skipped, so the
+// rest are still written.
+func (d *Deployment) writeArtifacts(dir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// The server log of remote deployments isn't available to us.
+	if !d.Remote {
+		if err := d.writeServerLog(ctx, filepath.Join(dir, "server.log")); err != nil {
+			return err
+		}
+	}
+
+	var templates []struct {
+		Name            string `json:"name"`
+		ActiveVersionID string `json:"active_version_id"`
+	}
+	if out, rc, err := d.exec(ctx, `coder templates list --output json`); err == nil && rc == 0 {
+		_ = json.Unmarshal([]byte(out), &templates)
+	}
+	for _, template := range templates {
+		d.writeJobLogs(ctx, filepath.Join(dir, "template-"+artifactsName(template.Name)+".log"),
+			"/api/v2/templateversions/"+template.ActiveVersionID+"/logs")
+	}
+
+	var workspaces []struct {
+		Name        string `json:"name"`
+		LatestBuild struct {
+			ID string `json:"id"`
+		} `json:"latest_build"`
+	}
+	if out, rc, err := d.exec(ctx, `coder list --output json`); err == nil && rc == 0 {
+		_ = json.Unmarshal([]byte(out), &workspaces)
+	}
+	for _, workspace := range workspaces {
+		d.writeJobLogs(ctx, filepath.Join(dir, "workspace-"+artifactsName(workspace.Name)+".log"),
+			"/api/v2/workspacebuilds/"+workspace.LatestBuild.ID+"/logs")
+	}
+	return nil
+}
+
+// writeServerLog writes the log of the container of the deployment to path.
+func (d *Deployment) writeServerLog(ctx context.Context, path string) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("connect to docker: %w", err)
+	}
+	defer cli.Close()
+	logs, err := cli.ContainerLogs(ctx, d.ContainerID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return fmt.Errorf("get server logs: %w", err)
+	}
+	defer logs.Close()
+	var buf bytes.Buffer
+	if _, err := stdcopy.StdCopy(&buf, &buf, logs); err != nil {
+		return fmt.Errorf("read server logs: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// writeJobLogs writes the logs of the provisioner job at the API path to
+// path, one line per log.
+func (d *Deployment) writeJobLogs(ctx context.Context, path, apiPath string) {
+	out, rc, err := d.exec(ctx, d.apiCommand(apiPath))
+	if err != nil || rc != 0 {
+		d.t.Logf("get logs from %s: exit code %d: %v", apiPath, rc, err)
+		return
+	}
+	var logs []struct {
+		CreatedAt string `json:"created_at"`
+		Stage     string `json:"stage"`
+		Output    string `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(out), &logs); err != nil {
+		d.t.Logf("decode logs from %s: %s", apiPath, err)
+		return
+	}
+	var buf bytes.Buffer
+	for _, log := range logs {
+		fmt.Fprintf(&buf, "%s [%s] %s\n", log.CreatedAt, log.Stage, log.Output)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		d.t.Logf("write %s: %s", path, err)
+	}
+}
+
+// artifactsName makes name, such as the name of a subtest, safe to use as a
+// file name.
+func artifactsName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// AssertOutput asserts that, for each key-value pair in expected:
+// 1. actual[k] as a regex matches expected[k], and
+// 2. the set of keys of expected are not a subset of actual.
+func AssertOutput(t testing.TB, expected, actual map[string]string) {
+	t.Helper()
+
+	for expectedKey, expectedValExpr := range expected {
+		actualVal := actual[expectedKey]
+		assert.Regexp(t, expectedValExpr, actualVal)
+	}
+	for actualKey := range actual {
+		_, ok := expected[actualKey]
+		assert.True(t, ok, "unexpected field in actual %q=%q", actualKey, actual[actualKey])
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,87 @@
+package coderprovidertest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/require"
+)
+
+// NewNetwork creates a Docker network for a deployment and its sidecars to
+// reach each other by name, and returns its name. Pass it in
+// Options.Network. The network is removed when the test finishes.
+func NewNetwork(ctx context.Context, t testing.TB) string {
+	t.Helper()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err, "init docker client")
+	defer cli.Close()
+
+	name := "coderprovidertest-" + strings.ToLower(artifactsName(t.Name()))
+	resp, err := cli.NetworkCreate(ctx, name, types.NetworkCreate{})
+	require.NoError(t, err, "create network")
+	t.Logf("created network %s\n", name)
+	// Registered before the cleanups of the containers on the network, so it
+	// runs after them.
+	t.Cleanup(func() {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			t.Logf("connect to docker: %s", err)
+			return
+		}
+		defer cli.Close()
+		_ = cli.NetworkRemove(context.Background(), resp.ID)
+	})
+	return name
+}
+
+// StartSidecar starts a container from ref on networkName, reachable from
+// the deployment as alias, such as a fake external service. The image is
+// pulled if it's missing. The container is removed when the test finishes.
+func StartSidecar(ctx context.Context, t testing.TB, networkName, alias, ref string, env []string) {
+	t.Helper()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err, "init docker client")
+	defer cli.Close()
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, ref); client.IsErrNotFound(err) {
+		t.Logf("pulling %s", ref)
+		pull, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+		require.NoError(t, err, "pull %s", ref)
+		_, err = io.Copy(io.Discard, pull)
+		_ = pull.Close()
+		require.NoError(t, err, "pull %s", ref)
+	}
+
+	ctr, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: ref,
+		Env:   env,
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode(networkName),
+	}, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{alias}},
+		},
+	}, nil, "")
+	require.NoError(t, err, "create sidecar %s", alias)
+	t.Cleanup(func() {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			t.Logf("connect to docker: %s", err)
+			return
+		}
+		defer cli.Close()
+		_ = cli.ContainerRemove(context.Background(), ctr.ID, container.RemoveOptions{
+			Force: true,
+		})
+	})
+	err = cli.ContainerStart(ctx, ctr.ID, container.StartOptions{})
+	require.NoError(t, err, "start sidecar %s", alias)
+	t.Logf("started sidecar %s from %s", alias, ref)
+}
@@ -1,24 +1,16 @@
 package integration
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
-	"runtime"
 	"strconv"
-	"strings"
 	"testing"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
-	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/coder/terraform-provider-coder/integration/coderprovidertest"
 )
 
 // TestIntegration performs an integration test against an ephemeral Coder deployment.
@@ -28,8 +20,8 @@ import (
 //     local_file resource containing JSON that can be marshalled as a map[string]string
 //   - Fetches the content of the JSON file created and compares it against the expected output.
 //
-// NOTE: all interfaces to this Coder deployment are performed without github.com/coder/coder/v2/codersdk
-// in order to avoid a circular dependency.
+// The deployment is managed by the coderprovidertest package, which template
+// authors can use to test their own templates the same way.
 func TestIntegration(t *testing.T) {
 	if os.Getenv("TF_ACC") == "1" {
 		t.Skip("Skipping integration tests during tf acceptance tests")
@@ -45,20 +37,29 @@ func TestIntegration(t *testing.T) {
 	t.Cleanup(cancel)
 
 	// Given: we have an existing Coder deployment running locally
-	ctrID := setup(ctx, t)
+	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+		// The repo root, containing the built binary.
+		ProviderDir:  "..",
+		TemplatesDir: ".",
+	})
+	if deployment.Remote {
+		t.Skip("Skipping template outputs, they can't be read from a remote deployment")
+	}
 
 	for _, tt := range []struct {
 		// Name of the folder under `integration/` containing a test template
 		templateName string
-		// map of string to regex to be passed to assertOutput()
+		// Parameters to create the workspace with
+		parameters map[string]string
+		// map of string to regex to be passed to coderprovidertest.AssertOutput()
 		expectedOutput map[string]string
 	}{
 		{
 			templateName: "test-data-source",
 			expectedOutput: map[string]string{
-				"provisioner.arch":                  runtime.GOARCH,
+				"provisioner.arch":                  deployment.Arch,
 				"provisioner.id":                    `[a-zA-Z0-9-]+`,
-				"provisioner.os":                    runtime.GOOS,
+				"provisioner.os":                    `linux`,
 				"workspace.access_port":             `\d+`,
 				"workspace.access_url":              `https?://\D+:\d+`,
 				"workspace.id":                      `[a-zA-z0-9-]+`,
@@ -86,162 +87,200 @@ func TestIntegration(t *testing.T) {
 				"workspace_owner.ssh_public_key":    `^$`, // Depends on coder/coder#13366
 			},
 		},
+		{
+			templateName: "test-dynamic-parameters",
+			parameters: map[string]string{
+				"gpu":  "false",
+				"size": "large",
+			},
+			expectedOutput: map[string]string{
+				"gpu_type.value":     `none`,
+				"gpu_type.visible":   `false`,
+				"memory.visible":     `true`,
+				"memory.form":        `"default_rules":\[\{"parameter":"size"`,
+				"size.option_values": `\["small","large"\]`,
+			},
+		},
 	} {
 		t.Run(tt.templateName, func(t *testing.T) {
+			outputPath := fmt.Sprintf("/tmp/%s.json", tt.templateName)
 			// Import named template
-			_, rc := execContainer(ctx, t, ctrID, fmt.Sprintf(`coder templates push %s --directory /src/integration/%s --var output_path=/tmp/%s.json --yes`, tt.templateName, tt.templateName, tt.templateName))
-			require.Equal(t, 0, rc)
+			deployment.PushTemplate(ctx, tt.templateName, map[string]string{"output_path": outputPath})
 			// Create a workspace
-			_, rc = execContainer(ctx, t, ctrID, fmt.Sprintf(`coder create %s -t %s --yes`, tt.templateName, tt.templateName))
-			require.Equal(t, 0, rc)
+			deployment.CreateWorkspaceWithParameters(ctx, tt.templateName, tt.templateName, tt.parameters)
 			// Fetch the output created by the template
-			out, rc := execContainer(ctx, t, ctrID, fmt.Sprintf(`cat /tmp/%s.json`, tt.templateName))
-			require.Equal(t, 0, rc)
-			actual := make(map[string]string)
-			require.NoError(t, json.NewDecoder(strings.NewReader(out)).Decode(&actual))
-			assertOutput(t, tt.expectedOutput, actual)
+			actual := deployment.ReadJSON(ctx, outputPath)
+			coderprovidertest.AssertOutput(t, tt.expectedOutput, actual)
 		})
 	}
 }
 
-func setup(ctx context.Context, t *testing.T) string {
-	var (
-		// For this test to work, we pass in a custom terraformrc to use
-		// the locally built version of the provider.
-		testTerraformrc = `provider_installation {
-		dev_overrides {
-		  "coder/coder" = "/src"
-		}
-		  direct{}
-	  }`
-		localURL = "http://localhost:3000"
-	)
-
-	coderImg := os.Getenv("CODER_IMAGE")
-	if coderImg == "" {
-		coderImg = "ghcr.io/coder/coder"
+// TestIntegrationAgent creates a workspace whose agent connects back to the
+// deployment, and asserts that it runs its startup script and reports its
+// app as healthy.
+func TestIntegrationAgent(t *testing.T) {
+	if os.Getenv("TF_ACC") == "1" {
+		t.Skip("Skipping integration tests during tf acceptance tests")
 	}
 
-	coderVersion := os.Getenv("CODER_VERSION")
-	if coderVersion == "" {
-		coderVersion = "latest"
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	t.Cleanup(cancel)
 
-	t.Logf("using coder image %s:%s", coderImg, coderVersion)
+	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+		ProviderDir:  "..",
+		TemplatesDir: ".",
+	})
+	deployment.PushTemplate(ctx, "test-agent", nil)
+	deployment.CreateWorkspace(ctx, "test-agent", "test-agent")
+
+	var agent coderprovidertest.Agent
+	require.Eventually(t, func() bool {
+		agents := deployment.Workspace(ctx, "test-agent").Agents()
+		require.Len(t, agents, 1)
+		agent = agents[0]
+		t.Logf("agent %q is %s (%s)", agent.Name, agent.Status, agent.LifecycleState)
+		return agent.LifecycleState == "ready"
+	}, 5*time.Minute, 5*time.Second, "agent failed to become ready in time")
+	require.Equal(t, "connected", agent.Status)
+
+	require.Contains(t, deployment.AgentLogs(ctx, agent.ID), "integration-startup-script-ok")
+
+	require.Eventually(t, func() bool {
+		apps := deployment.Workspace(ctx, "test-agent").Agents()[0].Apps
+		require.Len(t, apps, 1)
+		t.Logf("app %q is %s", apps[0].Slug, apps[0].Health)
+		return apps[0].Health == "healthy"
+	}, time.Minute, time.Second, "app failed to become healthy in time")
+}
 
-	// Ensure the binary is built
-	binPath, err := filepath.Abs("../terraform-provider-coder")
-	require.NoError(t, err)
-	if _, err := os.Stat(binPath); os.IsNotExist(err) {
-		t.Fatalf("not found: %q - please build the provider first", binPath)
+// TestIntegrationEnterprise covers provider features that are only
+// available with an enterprise license. It only runs when a license is
+// provided in $CODER_LICENSE.
+func TestIntegrationEnterprise(t *testing.T) {
+	if os.Getenv("TF_ACC") == "1" {
+		t.Skip("Skipping integration tests during tf acceptance tests")
 	}
-	tmpDir := t.TempDir()
-	// Create a terraformrc to point to our freshly built provider!
-	tfrcPath := filepath.Join(tmpDir, "integration.tfrc")
-	err = os.WriteFile(tfrcPath, []byte(testTerraformrc), 0o644)
-	require.NoError(t, err, "write terraformrc to tempdir")
-
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	require.NoError(t, err, "init docker client")
-
-	srcPath, err := filepath.Abs("..")
-	require.NoError(t, err, "get abs path of parent")
-	t.Logf("src path is %s\n", srcPath)
-
-	// Stand up a temporary Coder instance
-	ctr, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: coderImg + ":" + coderVersion,
-		Env: []string{
-			"CODER_ACCESS_URL=" + localURL,             // Set explicitly to avoid creating try.coder.app URLs.
-			"CODER_IN_MEMORY=true",                     // We don't necessarily care about real persistence here.
-			"CODER_TELEMETRY_ENABLE=false",             // Avoid creating noise.
-			"TF_CLI_CONFIG_FILE=/tmp/integration.tfrc", // Our custom tfrc from above.
-		},
-		Labels: map[string]string{},
-	}, &container.HostConfig{
-		Binds: []string{
-			tfrcPath + ":/tmp/integration.tfrc", // Custom tfrc from above.
-			srcPath + ":/src",                   // Bind-mount in the repo with the built binary and templates.
-		},
-	}, nil, nil, "")
-	require.NoError(t, err, "create test deployment")
-
-	t.Logf("created container %s\n", ctr.ID)
-	t.Cleanup(func() { // Make sure we clean up after ourselves.
-		// TODO: also have this execute if you Ctrl+C!
-		t.Logf("stopping container %s\n", ctr.ID)
-		_ = cli.ContainerRemove(ctx, ctr.ID, container.RemoveOptions{
-			Force: true,
-		})
+	if os.Getenv("CODER_LICENSE") == "" {
+		t.Skip("Skipping enterprise integration tests, CODER_LICENSE is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	t.Cleanup(cancel)
+
+	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+		ProviderDir:  "..",
+		TemplatesDir: ".",
 	})
 
-	err = cli.ContainerStart(ctx, ctr.ID, container.StartOptions{})
-	require.NoError(t, err, "start container")
-	t.Logf("started container %s\n", ctr.ID)
+	// Groups are an enterprise feature, so only appear in the owner's groups
+	// with a license.
+	_, rc := deployment.Exec(ctx, `coder groups create integration`)
+	require.Equal(t, 0, rc, "create group")
+	t.Cleanup(func() {
+		// Remote deployments outlive the test.
+		_, _ = deployment.Exec(context.Background(), `coder groups delete integration`)
+	})
+	_, rc = deployment.Exec(ctx, fmt.Sprintf(`coder groups edit integration --add-users %s`, coderprovidertest.Username))
+	require.Equal(t, 0, rc, "add user to group")
 
-	// nolint:gosec // For testing only.
-	var (
-		testEmail    = "testing@coder.com"
-		testPassword = "InsecurePassw0rd!"
-		testUsername = "testing"
-	)
+	outputPath := "/tmp/test-enterprise.json"
+	deployment.PushTemplate(ctx, "test-enterprise", map[string]string{"output_path": outputPath})
+	deployment.CreateWorkspace(ctx, "test-enterprise", "test-enterprise")
 
-	// Wait for container to come up
-	require.Eventually(t, func() bool {
-		_, rc := execContainer(ctx, t, ctr.ID, fmt.Sprintf(`curl -s --fail %s/api/v2/buildinfo`, localURL))
-		if rc == 0 {
-			return true
+	coderprovidertest.AssertOutput(t, map[string]string{
+		"workspace.owner_groups": `"integration"`,
+		"workspace_owner.groups": `"integration"`,
+	}, deployment.ReadJSON(ctx, outputPath))
+
+	sharingLevels := make(map[string]string)
+	for _, agent := range deployment.Workspace(ctx, "test-enterprise").Agents() {
+		for _, app := range agent.Apps {
+			sharingLevels[app.Slug] = app.SharingLevel
 		}
-		t.Logf("not ready yet...")
-		return false
-	}, 10*time.Second, time.Second, "coder failed to become ready in time")
-
-	// Perform first time setup
-	_, rc := execContainer(ctx, t, ctr.ID, fmt.Sprintf(`coder login %s --first-user-email=%q --first-user-password=%q --first-user-trial=false --first-user-username=%q`, localURL, testEmail, testPassword, testUsername))
-	require.Equal(t, 0, rc, "failed to perform first-time setup")
-	return ctr.ID
+	}
+	require.Equal(t, map[string]string{
+		"authenticated": "authenticated",
+		"public":        "public",
+	}, sharingLevels)
 }
 
-// execContainer executes the given command in the given container and returns
-// the output and the exit code of the command.
-func execContainer(ctx context.Context, t *testing.T, containerID, command string) (string, int) {
-	t.Helper()
-	t.Logf("exec container cmd: %q", command)
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	require.NoError(t, err, "connect to docker")
-	defer cli.Close()
-	execConfig := types.ExecConfig{
-		AttachStdout: true,
-		AttachStderr: true,
-		Cmd:          []string{"/bin/sh", "-c", command},
+// TestIntegrationUpgrade applies a template with a released version of the
+// provider, and asserts that planning it with the local build doesn't
+// replace any resources. The release defaults to the latest one, and can be
+// set with $PROVIDER_PREVIOUS_VERSION.
+func TestIntegrationUpgrade(t *testing.T) {
+	if os.Getenv("TF_ACC") == "1" {
+		t.Skip("Skipping integration tests during tf acceptance tests")
 	}
-	ex, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
-	require.NoError(t, err, "create container exec")
-	resp, err := cli.ContainerExecAttach(ctx, ex.ID, types.ExecStartCheck{})
-	require.NoError(t, err, "attach to container exec")
-	defer resp.Close()
-	var buf bytes.Buffer
-	_, err = stdcopy.StdCopy(&buf, &buf, resp.Reader)
-	require.NoError(t, err, "read stdout")
-	out := buf.String()
-	t.Log("exec container output:\n" + out)
-	execResp, err := cli.ContainerExecInspect(ctx, ex.ID)
-	require.NoError(t, err, "get exec exit code")
-	return out, execResp.ExitCode
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	t.Cleanup(cancel)
+
+	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+		ProviderDir:  "..",
+		TemplatesDir: ".",
+	})
+	if deployment.Remote {
+		t.Skip("Skipping upgrade tests, they need a local deployment")
+	}
+	changes := deployment.UpgradeChanges(ctx, "test-upgrade", os.Getenv("PROVIDER_PREVIOUS_VERSION"), nil)
+	require.Empty(t, changes, "upgrading the provider replaces resources")
 }
 
-// assertOutput asserts that, for each key-value pair in expected:
-// 1. actual[k] as a regex matches expected[k], and
-// 2. the set of keys of expected are not a subset of actual.
-func assertOutput(t *testing.T, expected, actual map[string]string) {
-	t.Helper()
+// TestIntegrationExternalAuth links the user with a fake OAuth2 provider, and
+// asserts the tokens templates get for linked and unlinked providers.
+func TestIntegrationExternalAuth(t *testing.T) {
+	if os.Getenv("TF_ACC") == "1" {
+		t.Skip("Skipping integration tests during tf acceptance tests")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	t.Cleanup(cancel)
 
-	for expectedKey, expectedValExpr := range expected {
-		actualVal := actual[expectedKey]
-		assert.Regexp(t, expectedValExpr, actualVal)
+	network := coderprovidertest.NewNetwork(ctx, t)
+	// Authorizes any client without a login form.
+	coderprovidertest.StartSidecar(ctx, t, network, "oauth2", "ghcr.io/navikt/mock-oauth2-server:2.1.10", nil)
+	var env []string
+	for i, id := range []string{"fake", "fake-unlinked"} {
+		prefix := fmt.Sprintf("CODER_EXTERNAL_AUTH_%d_", i)
+		env = append(env,
+			prefix+"ID="+id,
+			prefix+"TYPE="+id,
+			prefix+"CLIENT_ID="+id,
+			prefix+"CLIENT_SECRET=secret",
+			prefix+"AUTH_URL=http://oauth2:8080/default/authorize",
+			prefix+"TOKEN_URL=http://oauth2:8080/default/token",
+		)
 	}
-	for actualKey := range actual {
-		_, ok := expected[actualKey]
-		assert.True(t, ok, "unexpected field in actual %q=%q", actualKey, actual[actualKey])
+	deployment := coderprovidertest.New(ctx, t, coderprovidertest.Options{
+		ProviderDir:  "..",
+		TemplatesDir: ".",
+		Env:          env,
+		Network:      network,
+	})
+	if deployment.Remote {
+		t.Skip("Skipping external auth tests, they need a local deployment")
 	}
+	deployment.LinkExternalAuth(ctx, "fake")
+
+	t.Run("Linked", func(t *testing.T) {
+		outputPath := "/tmp/test-external-auth.json"
+		deployment.PushTemplate(ctx, "test-external-auth", map[string]string{"output_path": outputPath})
+		deployment.CreateWorkspace(ctx, "test-external-auth", "test-external-auth")
+		coderprovidertest.AssertOutput(t, map[string]string{
+			"linked.id":             `^fake$`,
+			"linked.access_token":   `.+`,
+			"unlinked.id":           `^fake-unlinked$`,
+			"unlinked.access_token": `^$`,
+		}, deployment.ReadJSON(ctx, outputPath))
+	})
+
+	t.Run("RequiredUnlinked", func(t *testing.T) {
+		deployment.PushTemplate(ctx, "test-external-auth-required", nil)
+		// The CLI waits for the user to link the provider, so give up on it
+		// after a while.
+		out, rc := deployment.Exec(ctx, `timeout 30 coder create test-external-auth-required -t test-external-auth-required --yes`)
+		require.NotEqual(t, 0, rc, "workspace was created without linking a required provider")
+		require.Regexp(t, `(?i)authenticate with`, out)
+	})
 }
@@ -0,0 +1,42 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+  }
+}
+
+data "coder_provisioner" "me" {}
+data "coder_workspace" "me" {}
+
+resource "coder_agent" "main" {
+  os             = "linux"
+  arch           = data.coder_provisioner.me.arch
+  startup_script = "echo integration-startup-script-ok"
+}
+
+# The deployment itself serves as the app, as the agent runs in its container.
+resource "coder_app" "coder" {
+  agent_id = coder_agent.main.id
+  slug     = "coder"
+  url      = "http://localhost:3000"
+  healthcheck {
+    url       = "http://localhost:3000/healthz"
+    interval  = 1
+    threshold = 10
+  }
+}
+
+# Rather than starting a container, the agent runs as a process next to the
+# deployment, which saves giving the deployment access to the Docker socket.
+resource "terraform_data" "agent" {
+  count = data.coder_workspace.me.start_count
+  input = coder_agent.main.id
+  provisioner "local-exec" {
+    command = "nohup sh -c \"$INIT_SCRIPT\" >/tmp/test-agent.log 2>&1 &"
+    environment = {
+      CODER_AGENT_TOKEN = coder_agent.main.token
+      INIT_SCRIPT       = coder_agent.main.init_script
+    }
+  }
+}
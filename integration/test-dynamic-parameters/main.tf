@@ -0,0 +1,79 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+    local = {
+      source = "hashicorp/local"
+    }
+  }
+}
+
+data "coder_parameter" "gpu" {
+  name    = "gpu"
+  type    = "bool"
+  default = true
+}
+
+data "coder_parameter" "gpu_type" {
+  name    = "gpu_type"
+  default = "none"
+  mutable = true
+  condition {
+    parameter = data.coder_parameter.gpu.name
+    values    = ["true"]
+  }
+}
+
+data "coder_parameter" "size" {
+  name    = "size"
+  default = "small"
+  option {
+    name  = "Small"
+    value = "small"
+  }
+  option {
+    name  = "Large"
+    value = "large"
+  }
+  option {
+    name  = "GPU"
+    value = "gpu"
+    condition {
+      parameter = data.coder_parameter.gpu.name
+      values    = ["true"]
+    }
+  }
+}
+
+data "coder_parameter" "memory" {
+  name    = "memory"
+  type    = "number"
+  default = 4
+  default_rule {
+    parameter = data.coder_parameter.size.name
+    values    = ["large"]
+    default   = 16
+  }
+}
+
+locals {
+  # NOTE: these must all be strings in the output
+  output = {
+    "gpu_type.value" : data.coder_parameter.gpu_type.value,
+    "gpu_type.visible" : tostring(data.coder_parameter.gpu_type.visible),
+    "memory.value" : data.coder_parameter.memory.value,
+    "memory.visible" : tostring(data.coder_parameter.memory.visible),
+    "memory.form" : data.coder_parameter.memory.form,
+    "size.option_values" : jsonencode([for o in jsondecode(data.coder_parameter.size.form).options : o.value if length(o.conditions) == 0]),
+  }
+}
+
+variable "output_path" {
+  type = string
+}
+
+resource "local_file" "output" {
+  filename = var.output_path
+  content  = jsonencode(local.output)
+}
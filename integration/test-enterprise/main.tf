@@ -0,0 +1,61 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+    local = {
+      source = "hashicorp/local"
+    }
+  }
+}
+
+// Exercises features that need an enterprise license: groups of the owner
+// and sharing apps beyond their owner. The agent never connects, but its
+// apps are still recorded with the build.
+data "coder_workspace" "me" {}
+data "coder_workspace_owner" "me" {}
+
+resource "coder_agent" "main" {
+  os   = "linux"
+  arch = "amd64"
+}
+
+resource "coder_app" "authenticated" {
+  agent_id = coder_agent.main.id
+  slug     = "authenticated"
+  url      = "http://localhost:8080"
+  share    = "authenticated"
+}
+
+resource "coder_app" "public" {
+  agent_id = coder_agent.main.id
+  slug     = "public"
+  url      = "http://localhost:8081"
+  share    = "public"
+}
+
+resource "terraform_data" "dev" {
+  input = coder_agent.main.id
+}
+
+locals {
+  # NOTE: these must all be strings in the output
+  output = {
+    "workspace.owner_groups" : jsonencode(data.coder_workspace.me.owner_groups),
+    "workspace_owner.groups" : jsonencode(data.coder_workspace_owner.me.groups),
+  }
+}
+
+variable "output_path" {
+  type = string
+}
+
+resource "local_file" "output" {
+  filename = var.output_path
+  content  = jsonencode(local.output)
+}
+
+output "output" {
+  value     = local.output
+  sensitive = true
+}
@@ -0,0 +1,13 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+  }
+}
+
+// The user never links this provider, so workspaces can't be created from
+// this template.
+data "coder_external_auth" "unlinked" {
+  id = "fake-unlinked"
+}
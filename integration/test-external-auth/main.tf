@@ -0,0 +1,45 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+    local = {
+      source = "hashicorp/local"
+    }
+  }
+}
+
+data "coder_external_auth" "linked" {
+  id = "fake"
+}
+
+// The user never links this provider, which doesn't block creating
+// workspaces as it's optional.
+data "coder_external_auth" "unlinked" {
+  id       = "fake-unlinked"
+  optional = true
+}
+
+locals {
+  # NOTE: these must all be strings in the output
+  output = {
+    "linked.id" : data.coder_external_auth.linked.id,
+    "linked.access_token" : data.coder_external_auth.linked.access_token,
+    "unlinked.id" : data.coder_external_auth.unlinked.id,
+    "unlinked.access_token" : data.coder_external_auth.unlinked.access_token,
+  }
+}
+
+variable "output_path" {
+  type = string
+}
+
+resource "local_file" "output" {
+  filename = var.output_path
+  content  = jsonencode(local.output)
+}
+
+output "output" {
+  value     = local.output
+  sensitive = true
+}
@@ -0,0 +1,84 @@
+terraform {
+  required_providers {
+    coder = {
+      source = "coder/coder"
+    }
+  }
+}
+
+// Applied with the previous release of the provider, then planned with the
+// local build, to catch changes that would replace the resources of existing
+// workspaces. Only use attributes the previous release supports.
+data "coder_workspace" "me" {}
+
+data "coder_parameter" "region" {
+  name    = "region"
+  type    = "string"
+  default = "eu"
+  mutable = true
+
+  option {
+    name  = "Europe"
+    value = "eu"
+  }
+  option {
+    name  = "United States"
+    value = "us"
+  }
+}
+
+resource "coder_agent" "main" {
+  os             = "linux"
+  arch           = "amd64"
+  dir            = "/home/coder"
+  startup_script = "echo hello"
+  env = {
+    REGION = data.coder_parameter.region.value
+  }
+
+  metadata {
+    key          = "load"
+    display_name = "Load"
+    script       = "cat /proc/loadavg"
+    interval     = 10
+    timeout      = 1
+  }
+}
+
+resource "coder_app" "code-server" {
+  agent_id     = coder_agent.main.id
+  slug         = "code-server"
+  display_name = "code-server"
+  icon         = "/icon/code.svg"
+  url          = "http://localhost:13337"
+  subdomain    = true
+  share        = "owner"
+
+  healthcheck {
+    url       = "http://localhost:13337/healthz"
+    interval  = 5
+    threshold = 6
+  }
+}
+
+resource "coder_script" "hello" {
+  agent_id     = coder_agent.main.id
+  display_name = "Hello"
+  script       = "echo hello"
+  run_on_start = true
+}
+
+resource "coder_env" "greeting" {
+  agent_id = coder_agent.main.id
+  name     = "GREETING"
+  value    = "hello"
+}
+
+resource "coder_metadata" "workspace" {
+  resource_id = coder_agent.main.id
+
+  item {
+    key   = "region"
+    value = data.coder_parameter.region.value
+  }
+}
@@ -2,14 +2,23 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf16"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"golang.org/x/xerrors"
 )
@@ -18,8 +27,16 @@ func agentResource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this resource to associate an agent.",
 		CreateContext: func(_ context.Context, resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			if name, _ := resourceData.Get("stable_id_name").(string); name != "" {
+				resourceData.SetId(deterministicID("agent", workspaceID(config.Env), name))
+			} else {
+				resourceData.SetId(uuid.NewString())
+			}
 			// This should be a real authentication token!
-			resourceData.SetId(uuid.NewString())
 			err := resourceData.Set("token", uuid.NewString())
 			if err != nil {
 				return diag.FromErr(err)
@@ -52,7 +69,7 @@ func agentResource() *schema.Resource {
 				itemKeys[key] = struct{}{}
 			}
 
-			return updateInitScript(resourceData, i)
+			return updateComputedAttributes(resourceData, i)
 		},
 		ReadWithoutTimeout: func(ctx context.Context, resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
 			err := resourceData.Set("token", uuid.NewString())
@@ -74,22 +91,121 @@ func agentResource() *schema.Resource {
 				}
 			}
 
-			return updateInitScript(resourceData, i)
+			return updateComputedAttributes(resourceData, i)
 		},
 		DeleteContext: func(ctx context.Context, resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
 			return nil
 		},
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			err := planMetadata(rd)
+			if err != nil {
+				return err
+			}
+			// Coder doesn't release the agent for 32-bit ARM on Windows, so
+			// the init script would fail to download it.
+			if rd.NewValueKnown("os") && rd.NewValueKnown("arch") {
+				operatingSystem, _ := rd.Get("os").(string)
+				arch, _ := rd.Get("arch").(string)
+				if operatingSystem == "windows" && arch == "armv7" {
+					return xerrors.New(`arch "armv7" isn't supported on "windows": use "amd64" or "arm64"`)
+				}
+			}
+			if !rd.NewValueKnown("env") {
+				return nil
+			}
+			env, _ := rd.Get("env").(map[string]interface{})
+			allowReserved, _ := rd.Get("allow_reserved_env").(bool)
+			names := make([]string, 0, len(env))
+			for name := range env {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				err = validateEnvName(name, allowReserved, "allow_reserved_env")
+				if err != nil {
+					return xerrors.Errorf("invalid env: %w", err)
+				}
+			}
+			return nil
+		},
 		Schema: map[string]*schema.Schema{
+			"stable_id_name": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Description: "Derive the ID of the agent from the workspace and this name instead of generating a new one on " +
+					"every build, so resources keyed on the agent ID such as DNS records aren't replaced. Use a name " +
+					"that is unique among the agents of the template. The token is still rotated on every build.",
+				ValidateFunc: validation.StringIsNotEmpty,
+			},
 			"init_script": {
 				Type:        schema.TypeString,
 				Computed:    true,
 				Description: "Run this script on startup of an instance to initialize the agent.",
 			},
+			"effective_env": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Description: "The environment the agent starts processes with: the CODER_* variables injected by Coder, " +
+					`overridden by "env". Variables set by "coder_env" resources aren't included, as they're created ` +
+					`after the agent, and override these in turn. CODER_AGENT_TOKEN is omitted.`,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"effective_env_sources": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Description: `The source of each variable in "effective_env": "coder" for variables injected by Coder, ` +
+					`or "env" for variables set by "env", whichever takes precedence.`,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"run_as_user": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Description: "The user the Linux init script starts the agent as. The init script must run as root, and " +
+					"creates the user if it doesn't exist, so base images that only ship root don't need a script " +
+					"to drop privileges.",
+				ValidateFunc: validation.StringMatch(linuxUserNameRegex, "must be a valid Linux user name"),
+			},
+			"windows_service": {
+				Type:     schema.TypeBool,
+				Default:  false,
+				ForceNew: true,
+				Optional: true,
+				Description: "Install the agent on Windows as a background task that runs as SYSTEM when the instance " +
+					"boots and is restarted if it fails, instead of running it in the foreground of the session that " +
+					"runs \"init_script\". The agent then survives RDP logoffs and reboots. The task is registered " +
+					"with the Task Scheduler as \"CoderAgent\" and runs the agent binary from " +
+					"\"%ProgramData%\\CoderAgent\". The \"CODER_AGENT_TOKEN\" of the session that runs \"init_script\" " +
+					"is stored there in a file only SYSTEM and administrators can read.",
+			},
+			"init_script_windows": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: `The "init_script" for a Windows instance with the same architecture as the agent.`,
+			},
+			"init_script_darwin": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: `The "init_script" for a macOS instance with the same architecture as the agent.`,
+			},
+			"init_command": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: `A single command line that runs the init script with the native shell, keyed by platform such as "linux/amd64" or "windows/arm64". Only platforms Coder provides an init script for are included.`,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
 			"arch": {
 				Type:         schema.TypeString,
 				ForceNew:     true,
 				Required:     true,
-				Description:  `The architecture the agent will run on. Must be one of: "amd64", "armv7", "arm64".`,
+				Description:  `The architecture the agent will run on. Must be one of: "amd64", "armv7", "arm64". "armv7" isn't supported on "windows".`,
 				ValidateFunc: validation.StringInSlice([]string{"amd64", "armv7", "arm64"}, false),
 			},
 			"auth": {
@@ -97,20 +213,57 @@ func agentResource() *schema.Resource {
 				Default:      "token",
 				ForceNew:     true,
 				Optional:     true,
-				Description:  `The authentication type the agent will use. Must be one of: "token", "google-instance-identity", "aws-instance-identity", "azure-instance-identity".`,
-				ValidateFunc: validation.StringInSlice([]string{"token", "google-instance-identity", "aws-instance-identity", "azure-instance-identity"}, false),
+				Description:  `The authentication type the agent will use. Must be one of: "token", "token-file", "google-instance-identity", "aws-instance-identity", "azure-instance-identity". "token-file" starts the agent with "token" auth, reading the token from "token_file_path" instead of the environment.`,
+				ValidateFunc: validation.StringInSlice([]string{"token", "token-file", "google-instance-identity", "aws-instance-identity", "azure-instance-identity"}, false),
+			},
+			"token_file_path": {
+				Type:         schema.TypeString,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  `The absolute path the agent reads its token from when "auth" is "token-file". Defaults to "` + defaultTokenFilePath + `".`,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^/[^/]`), "must be an absolute path"),
+			},
+			"token_file_pod_spec": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: `A JSON encoded Kubernetes pod spec fragment for "token-file" auth, with the "env", "volumes" and ` +
+					`"volumeMounts" entries that mount the token from a secret named "coder-agent-token-<id>" with the key ` +
+					`"token". The "env" starts the agent with "token" auth and "CODER_AGENT_TOKEN_FILE". Create the secret ` +
+					`from "token" and merge the fragment into the pod with "jsondecode()". Empty for other auth types.`,
+			},
+			"token_file_cloud_init": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+				Description: `A cloud-config document for "token-file" auth that writes "token" to "token_file_path", owned by ` +
+					`root with mode 0600. Add it as a part of the instance user data, such as with the "cloudinit_config" data ` +
+					`source, so the token is written to disk without appearing in the environment of any process. The init ` +
+					`scripts start the agent with "token" auth reading this file. Empty for other auth types. ` +
+					`The token is part of the user data, so anyone who can read it can impersonate the agent: any process on ` +
+					`the instance that can reach the metadata service, and anyone allowed to describe the instance in the cloud ` +
+					`provider's API. Block the metadata service from workloads, or write the file another way, such as from a ` +
+					`secrets manager, if that isn't acceptable.`,
 			},
 			"dir": {
-				Type:        schema.TypeString,
-				ForceNew:    true,
-				Optional:    true,
-				Description: "The starting directory when a user creates a shell session. Defaults to $HOME.",
+				Type:             schema.TypeString,
+				ForceNew:         true,
+				Optional:         true,
+				Description:      "The starting directory when a user creates a shell session. Defaults to $HOME.",
+				DiffSuppressFunc: suppressTrailingSlashDiff,
 			},
 			"env": {
+				ForceNew:         true,
+				Description:      "A mapping of environment variables to set inside the workspace.",
+				Type:             schema.TypeMap,
+				Optional:         true,
+				ValidateDiagFunc: warnEnvNames,
+			},
+			"allow_reserved_env": {
+				Type:        schema.TypeBool,
+				Default:     false,
 				ForceNew:    true,
-				Description: "A mapping of environment variables to set inside the workspace.",
-				Type:        schema.TypeMap,
 				Optional:    true,
+				Description: "Allow \"env\" to contain variables starting with \"CODER_\", overriding variables set by Coder.",
 			},
 			"os": {
 				Type:         schema.TypeString,
@@ -120,10 +273,11 @@ func agentResource() *schema.Resource {
 				ValidateFunc: validation.StringInSlice([]string{"linux", "darwin", "windows"}, false),
 			},
 			"startup_script": {
-				ForceNew:    true,
-				Description: `A script to run after the agent starts. The script should exit when it is done to signal that the agent is ready. This option is an alias for defining a "coder_script" resource with "run_on_start" set to true.`,
-				Type:        schema.TypeString,
-				Optional:    true,
+				ForceNew:         true,
+				Description:      `A script to run after the agent starts. The script should exit when it is done to signal that the agent is ready. This option is an alias for defining a "coder_script" resource with "run_on_start" set to true.`,
+				Type:             schema.TypeString,
+				Optional:         true,
+				DiffSuppressFunc: suppressLineEndingDiff,
 			},
 			"startup_script_timeout": {
 				Type:         schema.TypeInt,
@@ -135,10 +289,11 @@ func agentResource() *schema.Resource {
 				ValidateFunc: validation.IntAtLeast(1),
 			},
 			"shutdown_script": {
-				Type:        schema.TypeString,
-				ForceNew:    true,
-				Optional:    true,
-				Description: `A script to run before the agent is stopped. The script should exit when it is done to signal that the workspace can be stopped. This option is an alias for defining a "coder_script" resource with "run_on_stop" set to true.`,
+				Type:             schema.TypeString,
+				ForceNew:         true,
+				Optional:         true,
+				Description:      `A script to run before the agent is stopped. The script should exit when it is done to signal that the workspace can be stopped. This option is an alias for defining a "coder_script" resource with "run_on_stop" set to true.`,
+				DiffSuppressFunc: suppressLineEndingDiff,
 			},
 			"shutdown_script_timeout": {
 				Type:         schema.TypeInt,
@@ -164,6 +319,28 @@ func agentResource() *schema.Resource {
 				Description:  "Time in seconds until the agent is marked as timed out when a connection with the server cannot be established. A value of zero never marks the agent as timed out.",
 				ValidateFunc: validation.IntAtLeast(0),
 			},
+			"startup_timeout": {
+				Type:         schema.TypeInt,
+				Default:      0,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  `Time in seconds after the agent connects until its lifecycle status is marked as timed out, when the scripts that run on start haven't completed. This is measured separately from "connection_timeout", so long-running startup scripts don't require a long connection timeout. A value of zero never marks the agent as timed out.`,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"disable_direct_connections": {
+				Type:        schema.TypeBool,
+				Default:     false,
+				ForceNew:    true,
+				Optional:    true,
+				Description: "Relay all connections to the agent through DERP instead of attempting direct (peer-to-peer) connections. Use this when strict egress firewalls make direct connection attempts hang.",
+			},
+			"derp_region_id": {
+				Type:         schema.TypeInt,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  "The ID of the DERP region the agent uses as its home region, instead of the one with the lowest latency. Connections are relayed through this region when direct connections aren't possible.",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
 			"troubleshooting_url": {
 				Type:        schema.TypeString,
 				ForceNew:    true,
@@ -171,10 +348,19 @@ func agentResource() *schema.Resource {
 				Description: "A URL to a document with instructions for troubleshooting problems with the agent.",
 			},
 			"motd_file": {
-				Type:        schema.TypeString,
-				ForceNew:    true,
-				Optional:    true,
-				Description: "The path to a file within the workspace containing a message to display to users when they login via SSH. A typical value would be /etc/motd.",
+				Type:          schema.TypeString,
+				ForceNew:      true,
+				Optional:      true,
+				Description:   "The path to a file within the workspace containing a message to display to users when they login via SSH. A typical value would be /etc/motd.",
+				ConflictsWith: []string{"motd_content"},
+			},
+			"motd_content": {
+				Type:             schema.TypeString,
+				ForceNew:         true,
+				Optional:         true,
+				Description:      "A message to display to users when they login via SSH or the web terminal, such as a compliance banner or a list of the workspace's apps. Unlike \"motd_file\", the message doesn't need to exist in the workspace image.",
+				ConflictsWith:    []string{"motd_file"},
+				DiffSuppressFunc: suppressLineEndingDiff,
 			},
 			"login_before_ready": {
 				// Note: When this is removed, "startup_script_behavior" should
@@ -206,6 +392,8 @@ func agentResource() *schema.Resource {
 				Description: "Each \"metadata\" block defines a single item consisting of a key/value pair. This feature is in alpha and may break in future releases.",
 				ForceNew:    true,
 				Optional:    true,
+				// Computed so items can be added from "metadata_dir".
+				Computed: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"key": {
@@ -221,10 +409,11 @@ func agentResource() *schema.Resource {
 							Optional:    true,
 						},
 						"script": {
-							Type:        schema.TypeString,
-							Description: "The script that retrieves the value of this metadata item.",
-							ForceNew:    true,
-							Required:    true,
+							Type:             schema.TypeString,
+							Description:      "The script that retrieves the value of this metadata item.",
+							ForceNew:         true,
+							Required:         true,
+							DiffSuppressFunc: suppressLineEndingDiff,
 							Elem: &schema.Schema{
 								Type: schema.TypeString,
 							},
@@ -250,6 +439,16 @@ func agentResource() *schema.Resource {
 					},
 				},
 			},
+			"metadata_dir": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Description: "A directory of scripts to add as \"metadata\" items, relative to the template directory. " +
+					"Each file is an item keyed by its name without the extension. Scripts with a shebang line are run " +
+					"by that interpreter. Leading comments set the other fields, for example \"# interval: 10\", " +
+					"\"# timeout: 1\", \"# display_name: CPU Usage\" and \"# order: 1\". The interval is required.",
+				ValidateFunc: validation.StringIsNotEmpty,
+			},
 			"display_apps": {
 				Type:        schema.TypeSet,
 				Description: "The list of built-in apps to display in the agent bar.",
@@ -297,6 +496,120 @@ func agentResource() *schema.Resource {
 					},
 				},
 			},
+			"vscode": {
+				Type:        schema.TypeList,
+				Description: "Extensions and settings the agent applies to code-server and VS Code Remote sessions.",
+				ForceNew:    true,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"extensions": {
+							Type:        schema.TypeList,
+							Description: `The extensions to install, as "publisher.name" or "publisher.name@version".`,
+							ForceNew:    true,
+							Optional:    true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringMatch(vscodeExtensionRegex, `must be an extension ID like "publisher.name" or "publisher.name@version"`),
+							},
+						},
+						"settings": {
+							Type:             schema.TypeString,
+							Description:      "A JSON object of user settings, merged over the existing settings. Use jsonencode() to build it.",
+							ForceNew:         true,
+							Optional:         true,
+							ValidateFunc:     validation.StringIsJSON,
+							DiffSuppressFunc: structure.SuppressJsonDiff,
+						},
+						"marketplace_url": {
+							Type:         schema.TypeString,
+							Description:  "The URL of the extension marketplace to install extensions from, such as an internal Open VSX mirror. Defaults to the marketplace each editor is configured with.",
+							ForceNew:     true,
+							Optional:     true,
+							ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+						},
+					},
+				},
+			},
+			"jetbrains": {
+				Type:        schema.TypeList,
+				Description: "The IDEs offered by the JetBrains Gateway button in the agent bar.",
+				ForceNew:    true,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ide": {
+							Type:        schema.TypeList,
+							Description: "Each \"ide\" block is an IDE Gateway offers, in order. The first is preselected.",
+							ForceNew:    true,
+							Required:    true,
+							MinItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"product_code": {
+										Type:         schema.TypeString,
+										Description:  "The product code of the IDE. Must be one of: " + strings.Join(jetbrainsProductCodes, ", ") + ".",
+										ForceNew:     true,
+										Required:     true,
+										ValidateFunc: validation.StringInSlice(jetbrainsProductCodes, false),
+									},
+									"version": {
+										Type:         schema.TypeString,
+										Description:  `The release ("2024.1") or build number ("241.14494.240") of the IDE. Defaults to the latest release.`,
+										ForceNew:     true,
+										Optional:     true,
+										ValidateFunc: validation.StringMatch(regexp.MustCompile(`^\d+(\.\d+)+$`), "must be a release or build number"),
+									},
+									"config_template": {
+										Type:         schema.TypeString,
+										Description:  "The URL of a settings ZIP exported from the IDE, imported the first time the IDE starts in the workspace.",
+										ForceNew:     true,
+										Optional:     true,
+										ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"git_config": {
+				Type:        schema.TypeList,
+				Description: "The git identity and global git configuration the agent sets up in the workspace.",
+				ForceNew:    true,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"user_name": {
+							Type:        schema.TypeString,
+							Description: `The "user.name" to commit as. Defaults to the full name of the workspace owner, or their username if it's blank.`,
+							ForceNew:    true,
+							Optional:    true,
+							Computed:    true,
+						},
+						"user_email": {
+							Type:        schema.TypeString,
+							Description: `The "user.email" to commit as. Defaults to the email of the workspace owner.`,
+							ForceNew:    true,
+							Optional:    true,
+							Computed:    true,
+						},
+						"entries": {
+							Type:             schema.TypeMap,
+							Description:      `Other global git configuration, keyed by name, such as "pull.rebase" or "url.https://github.com/.insteadOf".`,
+							ForceNew:         true,
+							Optional:         true,
+							ValidateDiagFunc: validation.MapKeyMatch(gitConfigKeyRegex, `must be a git configuration key like "section.name"`),
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
 			"order": {
 				Type:        schema.TypeInt,
 				Description: "The order determines the position of agents in the UI presentation. The lowest order is shown first and agents with equal order are sorted by name (ascending order).",
@@ -323,6 +636,24 @@ func agentInstanceResource() *schema.Resource {
 		DeleteContext: func(c context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
 			return nil
 		},
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			// An instance can only authenticate as a single agent, so any
+			// further agents bound to it would never report in.
+			if !rd.NewValueKnown("agent_id") || !rd.NewValueKnown("instance_id") {
+				return nil
+			}
+			config, valid := i.(config)
+			if !valid {
+				return xerrors.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			agentID, _ := rd.Get("agent_id").(string)
+			instanceID, _ := rd.Get("instance_id").(string)
+			existing, ok := config.AgentInstances.claim("instance", instanceID, agentID)
+			if !ok && existing != agentID {
+				return xerrors.Errorf("instance %q is associated with multiple agents (%q and %q); each compute instance may only run a single agent", instanceID, existing, agentID)
+			}
+			return nil
+		},
 		Schema: map[string]*schema.Schema{
 			"agent_id": {
 				Type:        schema.TypeString,
@@ -340,6 +671,33 @@ func agentInstanceResource() *schema.Resource {
 	}
 }
 
+// agentPlatforms lists every operating system and architecture pair an
+// agent can run on.
+var agentPlatforms = [][2]string{
+	{"linux", "amd64"}, {"linux", "armv7"}, {"linux", "arm64"},
+	{"darwin", "amd64"}, {"darwin", "armv7"}, {"darwin", "arm64"},
+	{"windows", "amd64"}, {"windows", "armv7"}, {"windows", "arm64"},
+}
+
+// updateComputedAttributes sets the attributes of a "coder_agent" that are
+// derived from its configuration and the environment.
+func updateComputedAttributes(resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	for _, update := range []func() diag.Diagnostics{
+		func() diag.Diagnostics { return updateInitScript(resourceData, i) },
+		func() diag.Diagnostics { return updateEffectiveEnv(resourceData, i) },
+		func() diag.Diagnostics { return updateTokenFilePodSpec(resourceData) },
+		func() diag.Diagnostics { return updateTokenFileCloudInit(resourceData) },
+		func() diag.Diagnostics { return updateGitConfig(resourceData, i) },
+	} {
+		diags = append(diags, update()...)
+		if diags.HasError() {
+			return diags
+		}
+	}
+	return diags
+}
+
 // updateInitScript fetches parameters from a "coder_agent" to produce the
 // agent script from environment variables.
 func updateInitScript(resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
@@ -363,14 +721,448 @@ func updateInitScript(resourceData *schema.ResourceData, i interface{}) diag.Dia
 	if err != nil {
 		return diag.Errorf("parse access url: %s", err)
 	}
-	script := os.Getenv(fmt.Sprintf("CODER_AGENT_SCRIPT_%s_%s", operatingSystem, arch))
-	if script != "" {
-		script = strings.ReplaceAll(script, "${ACCESS_URL}", accessURL.String())
-		script = strings.ReplaceAll(script, "${AUTH_TYPE}", auth)
+	windowsService, _ := resourceData.Get("windows_service").(bool)
+	tokenFilePath := ""
+	if auth == "token-file" {
+		tokenFilePath = agentTokenFilePath(resourceData)
+	}
+	runAsUser, _ := resourceData.Get("run_as_user").(string)
+	replacer := strings.NewReplacer(
+		"${ACCESS_URL}", accessURL.String(),
+		"${AUTH_TYPE}", agentAuthType(auth),
+	)
+	err = resourceData.Set("init_script", initScript(replacer, operatingSystem, arch, windowsService, tokenFilePath, runAsUser))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	for _, scriptOS := range []string{"windows", "darwin"} {
+		err = resourceData.Set("init_script_"+scriptOS, initScript(replacer, scriptOS, arch, windowsService, tokenFilePath, runAsUser))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	commands := map[string]string{}
+	for _, platform := range agentPlatforms {
+		script := initScript(replacer, platform[0], platform[1], windowsService, tokenFilePath, runAsUser)
+		if script == "" {
+			continue
+		}
+		commands[platform[0]+"/"+platform[1]] = initCommand(platform[0], script)
+	}
+	err = resourceData.Set("init_command", commands)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+// agentAuthType returns the auth type the agent is started with for auth.
+// "token-file" is "token" auth, with the token read from
+// "CODER_AGENT_TOKEN_FILE" instead of "CODER_AGENT_TOKEN".
+func agentAuthType(auth string) string {
+	if auth == "token-file" {
+		return "token"
+	}
+	return auth
+}
+
+// defaultTokenFilePath is the path the agent reads its token from for
+// "token-file" auth when "token_file_path" isn't set. It isn't a schema
+// default, as adding one would replace agents created before the attribute
+// existed.
+const defaultTokenFilePath = "/var/run/secrets/coder/agent-token"
+
+// agentTokenFilePath returns the path the agent reads its token from for
+// "token-file" auth.
+func agentTokenFilePath(resourceData *schema.ResourceData) string {
+	tokenPath, _ := resourceData.Get("token_file_path").(string)
+	if tokenPath == "" {
+		return defaultTokenFilePath
+	}
+	return tokenPath
+}
+
+// updateTokenFileCloudInit sets the cloud-config document that writes the
+// agent token for "token-file" auth.
+func updateTokenFileCloudInit(resourceData *schema.ResourceData) diag.Diagnostics {
+	auth, _ := resourceData.Get("auth").(string)
+	document := ""
+	if auth == "token-file" {
+		tokenPath := agentTokenFilePath(resourceData)
+		token, _ := resourceData.Get("token").(string)
+		// JSON is valid YAML, and quotes the values safely.
+		files, err := json.Marshal([]map[string]string{{
+			"path":        tokenPath,
+			"content":     token,
+			"permissions": "0600",
+		}})
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		document = "#cloud-config\nwrite_files: " + string(files) + "\n"
+	}
+	err := resourceData.Set("token_file_cloud_init", document)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+// updateTokenFilePodSpec sets the pod spec fragment that mounts the agent
+// token for "token-file" auth.
+func updateTokenFilePodSpec(resourceData *schema.ResourceData) diag.Diagnostics {
+	auth, _ := resourceData.Get("auth").(string)
+	if auth != "token-file" {
+		err := resourceData.Set("token_file_pod_spec", "")
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		return nil
+	}
+	tokenPath := agentTokenFilePath(resourceData)
+	dir, file := path.Split(tokenPath)
+	const volume = "coder-agent-token"
+	spec, err := json.Marshal(map[string]interface{}{
+		// The agent has no "token-file" auth, it reads the token file with
+		// "token" auth.
+		"env": []map[string]interface{}{{
+			"name":  "CODER_AGENT_AUTH",
+			"value": agentAuthType(auth),
+		}, {
+			"name":  "CODER_AGENT_TOKEN_FILE",
+			"value": tokenPath,
+		}},
+		"volumes": []map[string]interface{}{{
+			"name": volume,
+			"secret": map[string]interface{}{
+				"secretName": "coder-agent-token-" + resourceData.Id(),
+				"items": []map[string]interface{}{{
+					"key":  "token",
+					"path": file,
+				}},
+			},
+		}},
+		"volumeMounts": []map[string]interface{}{{
+			"name":      volume,
+			"mountPath": dir,
+			"readOnly":  true,
+		}},
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	err = resourceData.Set("token_file_pod_spec", string(spec))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+// updateEffectiveEnv merges the variables Coder injects into every agent
+// with the "env" of a "coder_agent", matching the precedence of the agent.
+func updateEffectiveEnv(resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
+	config, valid := i.(config)
+	if !valid {
+		return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+	}
+	accessURL, err := config.URL.Parse("/")
+	if err != nil {
+		return diag.Errorf("parse access url: %s", err)
+	}
+	effective := map[string]interface{}{
+		"CODER":           "true",
+		"CODER_AGENT_URL": accessURL.String(),
+	}
+	for name, source := range map[string]string{
+		"CODER_WORKSPACE_NAME":       "CODER_WORKSPACE_NAME",
+		"CODER_WORKSPACE_OWNER_NAME": "CODER_WORKSPACE_OWNER",
+	} {
+		if value := config.Env.Get(source); value != "" {
+			effective[name] = value
+		}
+	}
+	sources := make(map[string]interface{}, len(effective))
+	for name := range effective {
+		sources[name] = "coder"
+	}
+	env, _ := resourceData.Get("env").(map[string]interface{})
+	for name, value := range env {
+		effective[name] = value
+		sources[name] = "env"
 	}
-	err = resourceData.Set("init_script", script)
+	config.AgentEnv.Store(resourceData.Id(), env)
+	err = resourceData.Set("effective_env", effective)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	err = resourceData.Set("effective_env_sources", sources)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+// updateGitConfig defaults the git identity of a "git_config" block to the
+// workspace owner.
+func updateGitConfig(resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
+	config, valid := i.(config)
+	if !valid {
+		return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+	}
+	blocks, _ := resourceData.Get("git_config").([]interface{})
+	if len(blocks) == 0 {
+		return nil
+	}
+	// An empty block has no attributes to read.
+	gitConfig, _ := blocks[0].(map[string]interface{})
+	if gitConfig == nil {
+		gitConfig = map[string]interface{}{}
+	}
+	if name, _ := gitConfig["user_name"].(string); name == "" {
+		name = config.Env.Get("CODER_WORKSPACE_OWNER_NAME")
+		if name == "" {
+			name = config.Env.Get("CODER_WORKSPACE_OWNER")
+		}
+		gitConfig["user_name"] = name
+	}
+	if email, _ := gitConfig["user_email"].(string); email == "" {
+		gitConfig["user_email"] = config.Env.Get("CODER_WORKSPACE_OWNER_EMAIL")
+	}
+	err := resourceData.Set("git_config", []interface{}{gitConfig})
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	return nil
 }
+
+// initScript renders the agent script for the platform from the
+// environment. It's empty if Coder didn't provide a script for it.
+func initScript(replacer *strings.Replacer, operatingSystem, arch string, windowsService bool, tokenFilePath, runAsUser string) string {
+	script := replacer.Replace(os.Getenv(fmt.Sprintf("CODER_AGENT_SCRIPT_%s_%s", operatingSystem, arch)))
+	if script == "" {
+		return ""
+	}
+	if operatingSystem == "windows" && windowsService {
+		return windowsServiceScript(replacer, arch, tokenFilePath)
+	}
+	if tokenFilePath != "" {
+		script = withTokenFile(script, operatingSystem, tokenFilePath)
+	}
+	if operatingSystem == "linux" && runAsUser != "" {
+		return runAsUserScript(script, runAsUser)
+	}
+	return script
+}
+
+// runAsUserScript wraps a Linux init script so it creates user if needed, and
+// runs the script as that user. The agent token is carried over in the script
+// file, which only the user can read, rather than on the command line.
+func runAsUserScript(script, user string) string {
+	return fmt.Sprintf(`#!/bin/sh
+set -eu
+user=%[1]s
+if [ "$(id -u)" != "0" ]; then
+	echo "Running the agent as $user requires root" >&2
+	exit 1
+fi
+if ! id -u "$user" >/dev/null 2>&1; then
+	if command -v useradd >/dev/null 2>&1; then
+		useradd --create-home --shell /bin/sh "$user"
+	else
+		adduser -D -s /bin/sh "$user"
+	fi
+fi
+script=$(mktemp)
+{
+	if [ -n "${CODER_AGENT_TOKEN:-}" ]; then
+		printf "export CODER_AGENT_TOKEN='%%s'\n" "$CODER_AGENT_TOKEN"
+	fi
+	cat <<'CODER_INIT_SCRIPT'
+%[2]s
+CODER_INIT_SCRIPT
+} >"$script"
+chmod 0700 "$script"
+chown "$user" "$script"
+exec su - "$user" -s /bin/sh -c "exec /bin/sh $script"
+`, user, script)
+}
+
+// withTokenFile makes the agent started by script read its token from path,
+// by exporting "CODER_AGENT_TOKEN_FILE" at the start of the script.
+func withTokenFile(script, operatingSystem, path string) string {
+	if operatingSystem == "windows" {
+		return fmt.Sprintf("$env:CODER_AGENT_TOKEN_FILE = '%s'\n", strings.ReplaceAll(path, "'", "''")) + script
+	}
+	export := "export CODER_AGENT_TOKEN_FILE='" + strings.ReplaceAll(path, "'", `'\''`) + "'\n"
+	// The interpreter line must stay first.
+	if strings.HasPrefix(script, "#!") {
+		shebang, rest, _ := strings.Cut(script, "\n")
+		return shebang + "\n" + export + rest
+	}
+	return export + script
+}
+
+// windowsServiceScript installs the agent on Windows as a task registered
+// with the Task Scheduler to run the agent binary as SYSTEM at boot,
+// restarting it on failure, instead of running it in the foreground of the
+// session that started it. The task doesn't inherit the environment of that
+// session, so the token is carried over in a file only SYSTEM and
+// administrators can read, and the rest of the agent's settings are flags.
+func windowsServiceScript(replacer *strings.Replacer, arch, tokenFilePath string) string {
+	return replacer.Replace(fmt.Sprintf(`$ErrorActionPreference = "Stop"
+$dir = Join-Path $env:ProgramData "CoderAgent"
+New-Item -ItemType Directory -Force -Path $dir | Out-Null
+icacls $dir /inheritance:r /grant:r "*S-1-5-18:(OI)(CI)F" "*S-1-5-32-544:(OI)(CI)F" | Out-Null
+# The binary can't be replaced while a previous agent is running.
+Stop-ScheduledTask -TaskName "CoderAgent" -ErrorAction SilentlyContinue
+$agent = Join-Path $dir "coder.exe"
+Invoke-WebRequest -Uri "${ACCESS_URL}bin/coder-windows-%[1]s.exe" -OutFile $agent -UseBasicParsing
+$tokenFile = '%[2]s'
+if (-not $tokenFile -and $env:CODER_AGENT_TOKEN) {
+	$tokenFile = Join-Path $dir "token"
+	Set-Content -Path $tokenFile -Value $env:CODER_AGENT_TOKEN -NoNewline
+}
+$arguments = "agent --auth ${AUTH_TYPE} --agent-url ${ACCESS_URL}"
+if ($tokenFile) {
+	$arguments += ' --agent-token-file "' + $tokenFile + '"'
+}
+$action = New-ScheduledTaskAction -Execute $agent -Argument $arguments
+$trigger = New-ScheduledTaskTrigger -AtStartup
+$principal = New-ScheduledTaskPrincipal -UserId "SYSTEM" -LogonType ServiceAccount -RunLevel Highest
+$settings = New-ScheduledTaskSettingsSet -AllowStartIfOnBatteries -DontStopIfGoingOnBatteries -ExecutionTimeLimit ([TimeSpan]::Zero) -RestartCount 999 -RestartInterval (New-TimeSpan -Minutes 1)
+Register-ScheduledTask -TaskName "CoderAgent" -Action $action -Trigger $trigger -Principal $principal -Settings $settings -Force | Out-Null
+Start-ScheduledTask -TaskName "CoderAgent"
+`, arch, strings.ReplaceAll(tokenFilePath, "'", "''")))
+}
+
+// initCommand wraps an init script in a single command line that runs it
+// with the native shell of the operating system.
+func initCommand(operatingSystem, script string) string {
+	if operatingSystem == "windows" {
+		return "powershell -NoProfile -NonInteractive -EncodedCommand " + encodePowerShellCommand(script)
+	}
+	return "sh -c '" + strings.ReplaceAll(script, "'", `'\''`) + "'"
+}
+
+// encodePowerShellCommand encodes script for the -EncodedCommand flag of
+// PowerShell, which expects base64 encoded UTF-16LE.
+func encodePowerShellCommand(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	raw := make([]byte, 0, len(encoded)*2)
+	for _, r := range encoded {
+		raw = append(raw, byte(r), byte(r>>8))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// planMetadata plans the "metadata" items configured in blocks, followed by
+// those read from "metadata_dir".
+func planMetadata(rd *schema.ResourceDiff) error {
+	configured := rd.GetRawConfig().GetAttr("metadata")
+	if !configured.IsWhollyKnown() || !rd.NewValueKnown("metadata_dir") {
+		return nil
+	}
+	items := []interface{}{}
+	if !configured.IsNull() {
+		for _, item := range configured.AsValueSlice() {
+			items = append(items, map[string]interface{}{
+				"key":          valueAsString(item.GetAttr("key")),
+				"display_name": valueAsString(item.GetAttr("display_name")),
+				"script":       valueAsString(item.GetAttr("script")),
+				"timeout":      valueAsInt(item.GetAttr("timeout")),
+				"interval":     valueAsInt(item.GetAttr("interval")),
+				"order":        valueAsInt(item.GetAttr("order")),
+			})
+		}
+	}
+	dir, _ := rd.Get("metadata_dir").(string)
+	if dir != "" {
+		dirItems, err := readMetadataDir(dir)
+		if err != nil {
+			return err
+		}
+		items = append(items, dirItems...)
+	}
+	return rd.SetNew("metadata", items)
+}
+
+// linuxUserNameRegex matches the user names useradd accepts by default.
+var linuxUserNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// jetbrainsProductCodes are the IDEs JetBrains Gateway can install remotely.
+var jetbrainsProductCodes = []string{"CL", "GO", "IU", "PS", "PY", "RD", "RM", "RR", "WS"}
+
+// gitConfigKeyRegex matches "section.name" and "section.subsection.name".
+var gitConfigKeyRegex = regexp.MustCompile(`^[A-Za-z0-9-]+(\..+)?\.[A-Za-z][A-Za-z0-9-]*$`)
+
+var vscodeExtensionRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*\.[A-Za-z0-9][A-Za-z0-9-]*(@[A-Za-z0-9.+-]+)?$`)
+
+var metadataHeaderRegex = regexp.MustCompile(`^#\s*(display_name|interval|timeout|order):\s*(.*?)\s*$`)
+
+// readMetadataDir reads each file in dir as a "metadata" item.
+func readMetadataDir(dir string) ([]interface{}, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("read metadata dir: %w", err)
+	}
+	items := []interface{}{}
+	keys := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		key := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if other, exists := keys[key]; exists {
+			return nil, xerrors.Errorf("metadata scripts %q and %q have the same key %q", other, path, key)
+		}
+		keys[key] = path
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, xerrors.Errorf("read metadata script: %w", err)
+		}
+		script := strings.ReplaceAll(string(data), "\r\n", "\n")
+		item := map[string]interface{}{
+			"key":          key,
+			"display_name": "",
+			"script":       script,
+			"timeout":      0,
+			"interval":     0,
+			"order":        0,
+		}
+		lines := strings.Split(script, "\n")
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if i == 0 && strings.HasPrefix(line, "#!") {
+				// The agent runs metadata scripts with a shell, so feed the
+				// script to its interpreter instead.
+				item["script"] = fmt.Sprintf("%s <<'CODER_METADATA_SCRIPT'\n%s\nCODER_METADATA_SCRIPT", strings.TrimSpace(strings.TrimPrefix(line, "#!")), strings.TrimSuffix(script, "\n"))
+				continue
+			}
+			if line == "" {
+				continue
+			}
+			if !strings.HasPrefix(line, "#") {
+				break
+			}
+			match := metadataHeaderRegex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			if match[1] == "display_name" {
+				item["display_name"] = match[2]
+				continue
+			}
+			value, err := strconv.Atoi(match[2])
+			if err != nil || value < 0 {
+				return nil, xerrors.Errorf("metadata script %q: %s must be a non-negative integer, got %q", path, match[1], match[2])
+			}
+			item[match[1]] = value
+		}
+		if item["interval"] == 0 {
+			return nil, xerrors.Errorf("metadata script %q must set an interval with a \"# interval: <seconds>\" comment", path)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
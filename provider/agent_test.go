@@ -1,8 +1,12 @@
 package provider_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
@@ -35,6 +39,9 @@ func TestAgent(t *testing.T) {
 					}
 					startup_script = "echo test"
 					startup_script_timeout = 120
+					startup_timeout = 1200
+					disable_direct_connections = true
+					derp_region_id = 999
 					troubleshooting_url = "https://example.com/troubleshoot"
 					motd_file = "/etc/motd"
 					shutdown_script = "echo bye bye"
@@ -57,6 +64,9 @@ func TestAgent(t *testing.T) {
 					"startup_script",
 					"startup_script_timeout",
 					"connection_timeout",
+					"startup_timeout",
+					"disable_direct_connections",
+					"derp_region_id",
 					"troubleshooting_url",
 					"motd_file",
 					"shutdown_script",
@@ -165,6 +175,630 @@ func TestAgent_StartupScriptBehavior(t *testing.T) {
 	}
 }
 
+func TestAgent_EnvNames(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		Name        string
+		Env         string
+		ExpectError *regexp.Regexp
+	}{{
+		// Names that aren't POSIX-compliant are only a warning.
+		Name: "Hyphen",
+		Env:  `{ "MY-VAR" = "value" }`,
+	}, {
+		Name:        "Reserved",
+		Env:         `{ CODER_AGENT_TOKEN = "value" }`,
+		ExpectError: regexp.MustCompile(`"CODER_AGENT_TOKEN" uses the reserved "CODER_" prefix; set allow_reserved_env`),
+	}, {
+		Name: "Valid",
+		Env:  `{ MY_VAR = "value" }`,
+	}} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			resource.Test(t, resource.TestCase{
+				Providers: map[string]*schema.Provider{
+					"coder": provider.New(),
+				},
+				IsUnitTest: true,
+				Steps: []resource.TestStep{{
+					Config: fmt.Sprintf(`
+					provider "coder" {
+						url = "https://example.com"
+					}
+					resource "coder_agent" "dev" {
+						os = "linux"
+						arch = "amd64"
+						env = %s
+					}
+					`, tc.Env),
+					ExpectError: tc.ExpectError,
+				}},
+			})
+		})
+	}
+}
+
+func TestAgent_InitCommand(t *testing.T) {
+	t.Setenv("CODER_AGENT_SCRIPT_linux_amd64", "echo '${ACCESS_URL}' ${AUTH_TYPE}")
+	t.Setenv("CODER_AGENT_SCRIPT_windows_amd64", "echo windows")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					auth = "token"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Equal(t, "echo 'https://example.com/' token", attrs["init_script"])
+				require.Equal(t, "echo windows", attrs["init_script_windows"])
+				require.Equal(t, "", attrs["init_script_darwin"])
+				require.Equal(t, "2", attrs["init_command.%"])
+				require.Equal(t, `sh -c 'echo '\''https://example.com/'\'' token'`, attrs["init_command.linux/amd64"])
+				// "echo windows" encoded as UTF-16LE.
+				require.Equal(t, "powershell -NoProfile -NonInteractive -EncodedCommand ZQBjAGgAbwAgAHcAaQBuAGQAbwB3AHMA", attrs["init_command.windows/amd64"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestAgent_WindowsService(t *testing.T) {
+	t.Setenv("CODER_AGENT_SCRIPT_windows_amd64", "echo windows")
+	t.Setenv("CODER_AGENT_SCRIPT_linux_amd64", "echo linux")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "windows"
+					arch = "amd64"
+					windows_service = true
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Contains(t, attrs["init_script"], "Register-ScheduledTask -TaskName \"CoderAgent\"")
+				require.Contains(t, attrs["init_script"], "-RestartCount")
+				// The task runs the agent itself, so the restart policy
+				// applies to it, with the token of the session in a file.
+				require.Contains(t, attrs["init_script"], `Invoke-WebRequest -Uri "https://example.com/bin/coder-windows-amd64.exe" -OutFile $agent`)
+				require.Contains(t, attrs["init_script"], `New-ScheduledTaskAction -Execute $agent -Argument $arguments`)
+				require.Contains(t, attrs["init_script"], `$arguments = "agent --auth token --agent-url https://example.com/"`)
+				require.Contains(t, attrs["init_script"], `Set-Content -Path $tokenFile -Value $env:CODER_AGENT_TOKEN`)
+				require.NotContains(t, attrs["init_script"], "echo windows")
+				require.Equal(t, attrs["init_script"], attrs["init_script_windows"])
+				// Only Windows scripts are installed as a service.
+				require.Equal(t, `sh -c 'echo linux'`, attrs["init_command.linux/amd64"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "windows"
+					arch = "armv7"
+					windows_service = true
+				}
+				`,
+			ExpectError: regexp.MustCompile(`arch "armv7" isn't supported on "windows"`),
+		}},
+	})
+}
+
+func TestAgent_MOTDContent(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					motd_content = "Authorized use only.\n"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				require.Equal(t, "Authorized use only.\n", resource.Primary.Attributes["motd_content"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					motd_file = "/etc/motd"
+					motd_content = "Authorized use only."
+				}
+				`,
+			ExpectError: regexp.MustCompile("conflicts with"),
+		}},
+	})
+}
+
+func TestAgent_VSCode(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					vscode {
+						extensions = ["golang.go", "ms-python.python@2024.0.1"]
+						settings = jsonencode({
+							"editor.tabSize" = 4
+						})
+						marketplace_url = "https://open-vsx.example.com"
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Equal(t, "2", attrs["vscode.0.extensions.#"])
+				require.Equal(t, "golang.go", attrs["vscode.0.extensions.0"])
+				require.Equal(t, "ms-python.python@2024.0.1", attrs["vscode.0.extensions.1"])
+				require.JSONEq(t, `{"editor.tabSize":4}`, attrs["vscode.0.settings"])
+				require.Equal(t, "https://open-vsx.example.com", attrs["vscode.0.marketplace_url"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					vscode {
+						extensions = ["not an extension"]
+					}
+				}
+				`,
+			ExpectError: regexp.MustCompile("must be an extension ID"),
+		}},
+	})
+}
+
+func TestAgent_JetBrains(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					jetbrains {
+						ide {
+							product_code = "GO"
+							version = "2024.1"
+							config_template = "https://example.com/settings.zip"
+						}
+						ide {
+							product_code = "IU"
+						}
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Equal(t, "2", attrs["jetbrains.0.ide.#"])
+				require.Equal(t, "GO", attrs["jetbrains.0.ide.0.product_code"])
+				require.Equal(t, "2024.1", attrs["jetbrains.0.ide.0.version"])
+				require.Equal(t, "https://example.com/settings.zip", attrs["jetbrains.0.ide.0.config_template"])
+				require.Equal(t, "IU", attrs["jetbrains.0.ide.1.product_code"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					jetbrains {
+						ide {
+							product_code = "XX"
+						}
+					}
+				}
+				`,
+			ExpectError: regexp.MustCompile("to be one of"),
+		}},
+	})
+}
+
+func TestAgent_GitConfig(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_OWNER", "jdoe")
+	t.Setenv("CODER_WORKSPACE_OWNER_NAME", "Jane Doe")
+	t.Setenv("CODER_WORKSPACE_OWNER_EMAIL", "jdoe@example.com")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "owner" {
+					os = "linux"
+					arch = "amd64"
+					git_config {}
+				}
+				resource "coder_agent" "custom" {
+					os = "linux"
+					arch = "amd64"
+					git_config {
+						user_email = "bot@example.com"
+						entries = {
+							"pull.rebase" = "true"
+							"url.https://github.com/.insteadOf" = "git@github.com:"
+						}
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				owner := state.Modules[0].Resources["coder_agent.owner"]
+				require.NotNil(t, owner)
+				require.Equal(t, "Jane Doe", owner.Primary.Attributes["git_config.0.user_name"])
+				require.Equal(t, "jdoe@example.com", owner.Primary.Attributes["git_config.0.user_email"])
+				custom := state.Modules[0].Resources["coder_agent.custom"]
+				require.NotNil(t, custom)
+				require.Equal(t, "Jane Doe", custom.Primary.Attributes["git_config.0.user_name"])
+				require.Equal(t, "bot@example.com", custom.Primary.Attributes["git_config.0.user_email"])
+				require.Equal(t, "true", custom.Primary.Attributes["git_config.0.entries.pull.rebase"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					git_config {
+						entries = {
+							"rebase" = "true"
+						}
+					}
+				}
+				`,
+			ExpectError: regexp.MustCompile("must be a git configuration key"),
+		}},
+	})
+}
+
+func TestAgent_RunAsUser(t *testing.T) {
+	t.Setenv("CODER_AGENT_SCRIPT_linux_amd64", "echo linux")
+	t.Setenv("CODER_AGENT_SCRIPT_windows_amd64", "echo windows")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					run_as_user = "coder"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Contains(t, attrs["init_script"], "user=coder\n")
+				require.Contains(t, attrs["init_script"], "useradd --create-home")
+				require.Contains(t, attrs["init_script"], "\necho linux\nCODER_INIT_SCRIPT\n")
+				require.Contains(t, attrs["init_script"], `exec su - "$user"`)
+				// Windows scripts aren't wrapped.
+				require.Equal(t, "echo windows", attrs["init_script_windows"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					run_as_user = "Not A User"
+				}
+				`,
+			ExpectError: regexp.MustCompile("must be a valid Linux user name"),
+		}},
+	})
+}
+
+func TestAgent_TokenFileDelivery(t *testing.T) {
+	t.Setenv("CODER_AGENT_SCRIPT_linux_amd64", "#!/usr/bin/env sh\necho linux")
+	t.Setenv("CODER_AGENT_SCRIPT_windows_amd64", "echo windows")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					auth = "token-file"
+					token_file_path = "/run/coder/token"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Equal(t, "#!/usr/bin/env sh\nexport CODER_AGENT_TOKEN_FILE='/run/coder/token'\necho linux", attrs["init_script"])
+				require.Equal(t, "$env:CODER_AGENT_TOKEN_FILE = '/run/coder/token'\necho windows", attrs["init_script_windows"])
+				require.NotContains(t, attrs["init_script"], attrs["token"])
+
+				cloudInit := attrs["token_file_cloud_init"]
+				require.True(t, strings.HasPrefix(cloudInit, "#cloud-config\nwrite_files: "))
+				var files []map[string]string
+				err := json.Unmarshal([]byte(strings.TrimPrefix(cloudInit, "#cloud-config\nwrite_files: ")), &files)
+				require.NoError(t, err)
+				require.Equal(t, []map[string]string{{
+					"path":        "/run/coder/token",
+					"content":     attrs["token"],
+					"permissions": "0600",
+				}}, files)
+				return nil
+			},
+		}},
+	})
+}
+
+// TestAgent_AuthType ensures the init script starts the agent with an auth
+// type it accepts for every "auth" of a "coder_agent".
+func TestAgent_AuthType(t *testing.T) {
+	t.Setenv("CODER_AGENT_SCRIPT_linux_amd64", "#!/usr/bin/env sh\nexport CODER_AGENT_AUTH=\"${AUTH_TYPE}\"")
+	// The values of "--auth" in "coder agent".
+	agentAuthTypes := []string{"token", "google-instance-identity", "aws-instance-identity", "azure-instance-identity"}
+	for _, auth := range []string{"token", "token-file", "google-instance-identity", "aws-instance-identity", "azure-instance-identity"} {
+		auth := auth
+		t.Run(auth, func(t *testing.T) {
+			resource.Test(t, resource.TestCase{
+				Providers: map[string]*schema.Provider{
+					"coder": provider.New(),
+				},
+				IsUnitTest: true,
+				Steps: []resource.TestStep{{
+					Config: fmt.Sprintf(`
+						provider "coder" {
+							url = "https://example.com"
+						}
+						resource "coder_agent" "new" {
+							os = "linux"
+							arch = "amd64"
+							auth = %q
+						}
+						`, auth),
+					Check: func(state *terraform.State) error {
+						require.Len(t, state.Modules, 1)
+						resource := state.Modules[0].Resources["coder_agent.new"]
+						require.NotNil(t, resource)
+						match := regexp.MustCompile(`(?m)^export CODER_AGENT_AUTH="(.*)"$`).FindStringSubmatch(resource.Primary.Attributes["init_script"])
+						require.Len(t, match, 2)
+						require.Contains(t, agentAuthTypes, match[1])
+						return nil
+					},
+				}},
+			})
+		})
+	}
+}
+
+func TestAgent_EffectiveEnv(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_NAME", "dev")
+	t.Setenv("CODER_WORKSPACE_OWNER", "owner123")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					allow_reserved_env = true
+					env = {
+						EDITOR = "vim"
+						CODER_WORKSPACE_NAME = "override"
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				for key, expected := range map[string]string{
+					"effective_env.%":                            "5",
+					"effective_env.CODER":                        "true",
+					"effective_env.CODER_AGENT_URL":              "https://example.com/",
+					"effective_env.CODER_WORKSPACE_NAME":         "override",
+					"effective_env.CODER_WORKSPACE_OWNER_NAME":   "owner123",
+					"effective_env.EDITOR":                       "vim",
+					"effective_env_sources.CODER":                "coder",
+					"effective_env_sources.CODER_WORKSPACE_NAME": "env",
+					"effective_env_sources.EDITOR":               "env",
+				} {
+					require.Equal(t, expected, resource.Primary.Attributes[key], key)
+				}
+				return nil
+			},
+		}},
+	})
+}
+
+func TestAgent_TokenFile(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					auth = "token-file"
+					token_file_path = "/run/coder/token"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				var spec struct {
+					Env []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"env"`
+					Volumes []struct {
+						Secret struct {
+							SecretName string `json:"secretName"`
+						} `json:"secret"`
+					} `json:"volumes"`
+					VolumeMounts []struct {
+						MountPath string `json:"mountPath"`
+					} `json:"volumeMounts"`
+				}
+				err := json.Unmarshal([]byte(resource.Primary.Attributes["token_file_pod_spec"]), &spec)
+				require.NoError(t, err)
+				require.Len(t, spec.Env, 2)
+				require.Equal(t, "CODER_AGENT_AUTH", spec.Env[0].Name)
+				require.Equal(t, "token", spec.Env[0].Value)
+				require.Equal(t, "CODER_AGENT_TOKEN_FILE", spec.Env[1].Name)
+				require.Equal(t, "/run/coder/token", spec.Env[1].Value)
+				require.Len(t, spec.Volumes, 1)
+				require.Equal(t, "coder-agent-token-"+resource.Primary.ID, spec.Volumes[0].Secret.SecretName)
+				require.Len(t, spec.VolumeMounts, 1)
+				require.Equal(t, "/run/coder/", spec.VolumeMounts[0].MountPath)
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					auth = "token-file"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["coder_agent.new"]
+				require.NotNil(t, resource)
+				require.Empty(t, resource.Primary.Attributes["token_file_path"])
+				require.Contains(t, resource.Primary.Attributes["token_file_pod_spec"], `"value":"/var/run/secrets/coder/agent-token"`)
+				require.Contains(t, resource.Primary.Attributes["token_file_cloud_init"], `"path":"/var/run/secrets/coder/agent-token"`)
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "new" {
+					os = "linux"
+					arch = "amd64"
+					auth = "token-file"
+					token_file_path = "token"
+				}
+				`,
+			ExpectError: regexp.MustCompile("must be an absolute path"),
+		}},
+	})
+}
+
 func TestAgent_Instance(t *testing.T) {
 	t.Parallel()
 	resource.Test(t, resource.TestCase{
@@ -206,6 +840,40 @@ func TestAgent_Instance(t *testing.T) {
 	})
 }
 
+func TestAgent_InstanceMultipleAgents(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_agent" "other" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_agent_instance" "dev" {
+					agent_id = coder_agent.dev.id
+					instance_id = "hello"
+				}
+				resource "coder_agent_instance" "other" {
+					agent_id = coder_agent.other.id
+					instance_id = "hello"
+				}
+				`,
+			ExpectError: regexp.MustCompile(`instance "hello" is associated with multiple agents`),
+		}},
+	})
+}
+
 func TestAgent_Metadata(t *testing.T) {
 	t.Parallel()
 	resource.Test(t, resource.TestCase{
@@ -290,6 +958,68 @@ func TestAgent_MetadataDuplicateKeys(t *testing.T) {
 	})
 }
 
+func TestAgent_MetadataDir(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "load.sh"), []byte("# display_name: Load\n# interval: 10\n# order: 2\ncat /proc/loadavg\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.py"), []byte("#!/usr/bin/env python3\n# interval: 30\n# timeout: 5\nprint(42)\n"), 0o600))
+	invalid := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(invalid, "disk.sh"), []byte("df -h\n"), 0o600))
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+					metadata_dir = %q
+					metadata {
+						key = "process_count"
+						script = "ps aux | wc -l"
+						interval = 5
+					}
+				}
+				`, dir),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_agent.dev"]
+				require.NotNil(t, resource)
+				attr := resource.Primary.Attributes
+				require.Equal(t, "3", attr["metadata.#"])
+				require.Equal(t, "process_count", attr["metadata.0.key"])
+				require.Equal(t, "load", attr["metadata.1.key"])
+				require.Equal(t, "Load", attr["metadata.1.display_name"])
+				require.Equal(t, "10", attr["metadata.1.interval"])
+				require.Equal(t, "2", attr["metadata.1.order"])
+				require.Equal(t, "# display_name: Load\n# interval: 10\n# order: 2\ncat /proc/loadavg\n", attr["metadata.1.script"])
+				require.Equal(t, "memory", attr["metadata.2.key"])
+				require.Equal(t, "30", attr["metadata.2.interval"])
+				require.Equal(t, "5", attr["metadata.2.timeout"])
+				require.Equal(t, "/usr/bin/env python3 <<'CODER_METADATA_SCRIPT'\n#!/usr/bin/env python3\n# interval: 30\n# timeout: 5\nprint(42)\nCODER_METADATA_SCRIPT", attr["metadata.2.script"])
+				return nil
+			},
+		}, {
+			Config: fmt.Sprintf(`
+				provider "coder" {
+					url = "https://example.com"
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+					metadata_dir = %q
+				}
+				`, invalid),
+			ExpectError: regexp.MustCompile("must set an interval"),
+		}},
+	})
+}
+
 func TestAgent_DisplayApps(t *testing.T) {
 	t.Parallel()
 	t.Run("OK", func(t *testing.T) {
@@ -467,3 +1197,98 @@ func TestAgent_DisplayApps(t *testing.T) {
 	})
 
 }
+
+func TestAgent_StableID(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_ID", "4a5b5c32-3e24-4d7b-9f6d-1b0c8d6a4e3f")
+
+	var firstID string
+	config := func(dir string) string {
+		return fmt.Sprintf(`
+			provider "coder" {
+				url = "https://example.com"
+			}
+			resource "coder_agent" "dev" {
+				os = "linux"
+				arch = "amd64"
+				dir = %q
+				stable_id_name = "dev"
+			}
+			resource "coder_agent" "other" {
+				os = "linux"
+				arch = "amd64"
+				stable_id_name = "other"
+			}
+			`, dir)
+	}
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config("/home/coder"),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				dev := state.Modules[0].Resources["coder_agent.dev"]
+				require.NotNil(t, dev)
+				other := state.Modules[0].Resources["coder_agent.other"]
+				require.NotNil(t, other)
+				require.NotEqual(t, dev.Primary.ID, other.Primary.ID)
+				firstID = dev.Primary.ID
+				return nil
+			},
+		}, {
+			// Replacing the agent keeps its ID, but rotates the token.
+			Config: config("/workspace"),
+			Check: func(state *terraform.State) error {
+				dev := state.Modules[0].Resources["coder_agent.dev"]
+				require.NotNil(t, dev)
+				require.Equal(t, "/workspace", dev.Primary.Attributes["dir"])
+				require.Equal(t, firstID, dev.Primary.ID)
+				return nil
+			},
+		}},
+	})
+}
+
+func TestAgent_NormalizedDiffs(t *testing.T) {
+	t.Parallel()
+	config := func(dir, newline string) string {
+		return fmt.Sprintf(`
+			provider "coder" {
+				url = "https://example.com"
+			}
+			resource "coder_agent" "new" {
+				os = "linux"
+				arch = "amd64"
+				dir = %q
+				startup_script = "#!/bin/sh%[2]secho hello%[2]s"
+				metadata {
+					key = "load"
+					script = "#!/bin/sh%[2]suptime%[2]s"
+					interval = 10
+				}
+			}
+			resource "coder_script" "new" {
+				agent_id = coder_agent.new.id
+				display_name = "Hello"
+				script = "#!/bin/sh%[2]secho hello%[2]s"
+				run_on_start = true
+			}
+			`, dir, newline)
+	}
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config("/home/coder/", `\r\n`),
+		}, {
+			// Only line endings and trailing slashes differ, so the plan
+			// must be empty.
+			Config:   config("/home/coder", `\n`),
+			PlanOnly: true,
+		}},
+	})
+}
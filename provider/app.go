@@ -2,16 +2,26 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/url"
+	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
 )
 
 var (
+	// localeRegex matches BCP 47 language tags such as "de" or "zh-Hant-TW".
+	localeRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
 	// appSlugRegex is the regex used to validate the slug of a coder_app
 	// resource. It must be a valid hostname and cannot contain two consecutive
 	// hyphens or start/end with a hyphen.
@@ -28,7 +38,16 @@ func appResource() *schema.Resource {
 		Description: "Use this resource to define shortcuts to access applications in a workspace.",
 		CreateContext: func(c context.Context, resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
 			resourceData.SetId(uuid.NewString())
-			return nil
+			// "cors_behavior" has no schema default, as adding one would
+			// replace apps created before it existed, so an empty value is
+			// "simple".
+			if corsBehavior, _ := resourceData.Get("cors_behavior").(string); corsBehavior == "" {
+				err := resourceData.Set("cors_behavior", "simple")
+				if err != nil {
+					return diag.FromErr(err)
+				}
+			}
+			return append(verifyHealthcheck(resourceData), verifyAppHost(resourceData)...)
 		},
 		ReadContext: func(c context.Context, resourceData *schema.ResourceData, i interface{}) diag.Diagnostics {
 			return nil
@@ -36,6 +55,47 @@ func appResource() *schema.Resource {
 		DeleteContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
 			return nil
 		},
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			config, valid := i.(config)
+			if !valid {
+				return xerrors.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			err := planAppURL(rd, config.Env)
+			if err != nil {
+				return err
+			}
+			for _, key := range []string{"icon", "preview_image"} {
+				err = planIcon(rd, config, key)
+				if err != nil {
+					return err
+				}
+			}
+			err = validateSubdomainOptions(rd)
+			if err != nil {
+				return err
+			}
+			err = validateLocales(rd)
+			if err != nil {
+				return err
+			}
+			err = validateHealthcheck(rd)
+			if err != nil {
+				return err
+			}
+			// The agent ID is usually unknown until the agent has been
+			// created, in which case the check runs when the plan is
+			// refreshed during apply.
+			if !rd.NewValueKnown("agent_id") || !rd.NewValueKnown("slug") {
+				return nil
+			}
+			agentID, _ := rd.Get("agent_id").(string)
+			slug, _ := rd.Get("slug").(string)
+			label := appLabel(rd)
+			if existing, ok := config.AppSlugs.claim(agentID, slug, label); !ok {
+				return xerrors.Errorf("duplicate coder_app slug %q on agent %q: used by both %q and %q", slug, agentID, existing, label)
+			}
+			return nil
+		},
 		Schema: map[string]*schema.Schema{
 			"agent_id": {
 				Type:        schema.TypeString,
@@ -56,17 +116,51 @@ func appResource() *schema.Resource {
 				Type: schema.TypeString,
 				Description: "A URL to an icon that will display in the dashboard. View built-in " +
 					"icons here: https://github.com/coder/coder/tree/main/site/static/icon. Use a " +
-					"built-in icon with `data.coder_workspace.me.access_url + \"/icon/<path>\"`.",
-				ForceNew: true,
-				Optional: true,
-				ValidateFunc: func(i interface{}, s string) ([]string, []error) {
-					_, err := url.Parse(s)
-					if err != nil {
-						return nil, []error{err}
-					}
-					return nil, nil
+					"built-in icon by name with `\"builtin:<name>\"`, such as `\"builtin:jupyter\"`, " +
+					"which is stored as its path, such as `\"/icon/jupyter.svg\"`. Planning warns about names " +
+					"that aren't among the icons known to the provider.",
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validateIcon,
+				StateFunc:    resolveIcon,
+			},
+			"locales": {
+				Type:        schema.TypeList,
+				Description: "Each \"locales\" block translates the app for users whose dashboard uses that locale. Users of other locales see the untranslated app.",
+				ForceNew:    true,
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"locale": {
+							Type:         schema.TypeString,
+							Description:  `The language tag of the locale, such as "de" or "pt-BR".`,
+							ForceNew:     true,
+							Required:     true,
+							ValidateFunc: validation.StringMatch(localeRegex, `must be a language tag such as "de" or "pt-BR"`),
+						},
+						"display_name": {
+							Type:        schema.TypeString,
+							Description: "The display name of the app in this locale.",
+							ForceNew:    true,
+							Optional:    true,
+						},
+						"description": {
+							Type:        schema.TypeString,
+							Description: "A description of the app in this locale.",
+							ForceNew:    true,
+							Optional:    true,
+						},
+					},
 				},
 			},
+			"preview_image": {
+				Type: schema.TypeString,
+				Description: "An image shown as the thumbnail of the app's card in the dashboard, for apps " +
+					"the icon doesn't describe well. Accepts the same paths, https:// URLs and data URIs as \"icon\".",
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validatePreviewImage,
+			},
 			"slug": {
 				Type: schema.TypeString,
 				Description: "A hostname-friendly name for the app. This is " +
@@ -111,6 +205,25 @@ func appResource() *schema.Resource {
 				ForceNew: true,
 				Optional: true,
 			},
+			"path_prefix": {
+				Type: schema.TypeString,
+				Description: "The path the app is opened at on its subdomain, for tools that are served under a " +
+					"fixed path such as \"/lab\". Requires \"subdomain\".",
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^/\S*$`), `must be a path starting with "/"`),
+			},
+			"additional_ports": {
+				Type: schema.TypeList,
+				Description: "Other ports in the workspace proxied under the subdomain of the app, for tools " +
+					"that serve parts of their UI from more than one port, such as Jupyter kernels. Requires \"subdomain\".",
+				ForceNew: true,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeInt,
+					ValidateFunc: validation.IsPortNumber,
+				},
+			},
 			"relative_path": {
 				Type:       schema.TypeBool,
 				Deprecated: "`relative_path` on apps is deprecated, use `subdomain` instead.",
@@ -124,9 +237,11 @@ func appResource() *schema.Resource {
 				Type: schema.TypeString,
 				Description: `Determines the "level" which the application ` +
 					`is shared at. Valid levels are "owner" (default), ` +
-					`"authenticated" and "public". Level "owner" disables ` +
+					`"organization", "authenticated" and "public". Level "owner" disables ` +
 					"sharing on the app, so only the workspace owner can " +
-					`access it. Level "authenticated" shares the app with ` +
+					`access it. Level "organization" shares the app with all ` +
+					"members of the workspace's organization. " +
+					`Level "authenticated" shares the app with ` +
 					`all authenticated users. Level "public" shares it with ` +
 					"any user, including unauthenticated users. Permitted " +
 					"application sharing levels can be configured site-wide " +
@@ -141,20 +256,37 @@ func appResource() *schema.Resource {
 					}
 
 					switch valStr {
-					case "owner", "authenticated", "public":
+					case "owner", "organization", "authenticated", "public":
 						return nil
 					}
 
-					return diag.Errorf(`invalid app share %q, must be one of "owner", "authenticated", "public"`, valStr)
+					return diag.Errorf(`invalid app share %q, must be one of "owner", "organization", "authenticated", "public"`, valStr)
 				},
 			},
+			"cors_behavior": {
+				Type: schema.TypeString,
+				Description: `Determines how the proxy handles CORS for the app. Valid behaviors are "simple" (default), ` +
+					`where the proxy adds its own CORS headers, and "passthru", where the CORS headers the app sets ` +
+					"are passed through unchanged, for apps that manage CORS themselves.",
+				ForceNew:     true,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"simple", "passthru"}, false),
+			},
 			"url": {
 				Type: schema.TypeString,
 				Description: "An external url if \"external=true\" or a URL to be proxied to from inside the workspace. " +
 					"This should be of the form \"http://localhost:PORT[/SUBPATH]\". " +
-					"Either \"command\" or \"url\" may be specified, but not both.",
-				ForceNew:      true,
-				Optional:      true,
+					"Either \"command\" or \"url\" may be specified, but not both. " +
+					"Proxied urls may also target hosts in the workspace's network, such as a sidecar container by " +
+					"IP or a Docker network alias. The agent proxies them to everyone the app is shared with, so a " +
+					"warning is shown for hosts that don't look like they're inside the workspace. " +
+					"External urls may contain the placeholders " + appURLPlaceholderList + ", which are " +
+					"replaced with the escaped values of the workspace being built.",
+				ForceNew: true,
+				Optional: true,
+				// Computed so placeholders can be replaced in the plan.
+				Computed:      true,
 				ConflictsWith: []string{"command"},
 			},
 			"external": {
@@ -193,9 +325,25 @@ func appResource() *schema.Resource {
 							ForceNew:    true,
 							Required:    true,
 						},
+						"verify": {
+							Type:        schema.TypeBool,
+							Description: "Report a warning during the workspace build if the healthcheck does not target the same port and path prefix as the app \"url\", which usually means the app will never become healthy.",
+							ForceNew:    true,
+							Optional:    true,
+							Default:     false,
+						},
 					},
 				},
 			},
+			"depends_on_script": {
+				Type: schema.TypeString,
+				Description: `The "id" property of a "coder_script" resource on the same agent. The app is shown as ` +
+					"starting until the script has completed successfully, so users can't open an app that is still " +
+					"being installed.",
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validation.IsUUID,
+			},
 			"order": {
 				Type:        schema.TypeInt,
 				Description: "The order determines the position of app in the UI presentation. The lowest order is shown first and apps with equal order are sorted by name (ascending order).",
@@ -205,3 +353,254 @@ func appResource() *schema.Resource {
 		},
 	}
 }
+
+// validateHealthcheck ensures the healthcheck of a "coder_app" is an HTTP URL
+// served from inside the workspace: on localhost, on the same host as the app
+// itself, or on a workspace host such as a sidecar.
+func validateHealthcheck(rd *schema.ResourceDiff) error {
+	if !rd.NewValueKnown("healthcheck") || !rd.NewValueKnown("url") {
+		return nil
+	}
+	healthcheck, ok := appHealthcheck(rd.Get("healthcheck"))
+	if !ok {
+		return nil
+	}
+	rawURL, _ := healthcheck["url"].(string)
+	if rawURL == "" {
+		// The URL is not known until apply.
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return xerrors.Errorf("invalid healthcheck url %q: %w", rawURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return xerrors.Errorf("invalid healthcheck url %q: scheme must be \"http\" or \"https\"", rawURL)
+	}
+	if isWorkspaceHost(parsed.Hostname()) {
+		return nil
+	}
+	appURL, _ := rd.Get("url").(string)
+	if parsedApp, err := url.Parse(appURL); err == nil && appURL != "" && parsedApp.Hostname() == parsed.Hostname() {
+		return nil
+	}
+	return xerrors.Errorf("invalid healthcheck url %q: must target localhost or the host of the app url, "+
+		"or a private address or unqualified host name such as a sidecar", rawURL)
+}
+
+// isWorkspaceHost reports whether host is likely served from inside the
+// workspace's network: a loopback or private address, or an unqualified name
+// such as a Docker network alias or a Kubernetes service in the same
+// namespace.
+func isWorkspaceHost(host string) bool {
+	if isLoopback(host) {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+	return host != "" && !strings.Contains(host, ".")
+}
+
+// verifyAppHost returns a warning for a proxied app outside the workspace's
+// network. The agent proxies requests with the access of the user, so the
+// app is exposed to anyone the app is shared with.
+func verifyAppHost(resourceData *schema.ResourceData) diag.Diagnostics {
+	if external, _ := resourceData.Get("external").(bool); external {
+		return nil
+	}
+	appURL, _ := resourceData.Get("url").(string)
+	parsed, err := url.Parse(appURL)
+	if err != nil || appURL == "" || isWorkspaceHost(parsed.Hostname()) {
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity:      diag.Warning,
+		Summary:       "App proxies a host outside the workspace",
+		Detail:        fmt.Sprintf("The app url %q isn't a localhost, private or unqualified address. The agent proxies it to everyone the app is shared with, which may expose a service that isn't part of the workspace.", appURL),
+		AttributePath: cty.GetAttrPath("url"),
+	}}
+}
+
+// validateSubdomainOptions ensures "path_prefix" and "additional_ports" are
+// only used by subdomain apps, and that the ports don't repeat the app port.
+func validateSubdomainOptions(rd *schema.ResourceDiff) error {
+	if !rd.NewValueKnown("path_prefix") || !rd.NewValueKnown("additional_ports") || !rd.NewValueKnown("subdomain") {
+		return nil
+	}
+	pathPrefix, _ := rd.Get("path_prefix").(string)
+	ports, _ := rd.Get("additional_ports").([]interface{})
+	if pathPrefix == "" && len(ports) == 0 {
+		return nil
+	}
+	if subdomain, _ := rd.Get("subdomain").(bool); !subdomain {
+		return xerrors.New(`"path_prefix" and "additional_ports" require "subdomain" to be true`)
+	}
+	appPort := ""
+	if rd.NewValueKnown("url") {
+		appURL, _ := rd.Get("url").(string)
+		if parsed, err := url.Parse(appURL); err == nil && appURL != "" {
+			appPort = urlPort(parsed)
+		}
+	}
+	seen := map[string]struct{}{}
+	for _, port := range ports {
+		value, _ := port.(int)
+		text := strconv.Itoa(value)
+		if text == appPort {
+			return xerrors.Errorf("additional port %s is already the port of the app url", text)
+		}
+		if _, exists := seen[text]; exists {
+			return xerrors.Errorf("duplicate additional port %s", text)
+		}
+		seen[text] = struct{}{}
+	}
+	return nil
+}
+
+// validateLocales ensures each locale of an app is translated once. Tags
+// are compared case-insensitively, as they are by browsers.
+func validateLocales(rd *schema.ResourceDiff) error {
+	if !rd.NewValueKnown("locales") {
+		return nil
+	}
+	locales, _ := rd.Get("locales").([]interface{})
+	seen := map[string]struct{}{}
+	for _, item := range locales {
+		locale, _ := item.(map[string]interface{})
+		tag, _ := locale["locale"].(string)
+		if _, exists := seen[strings.ToLower(tag)]; exists {
+			return xerrors.Errorf("duplicate locale %q", tag)
+		}
+		seen[strings.ToLower(tag)] = struct{}{}
+	}
+	return nil
+}
+
+// verifyHealthcheck returns warnings for a healthcheck with "verify" set that
+// targets a different port or path than the app, as the healthcheck is then
+// unlikely to reflect the readiness of the app.
+func verifyHealthcheck(resourceData *schema.ResourceData) diag.Diagnostics {
+	healthcheck, ok := appHealthcheck(resourceData.Get("healthcheck"))
+	if !ok {
+		return nil
+	}
+	if verify, _ := healthcheck["verify"].(bool); !verify {
+		return nil
+	}
+	appURL, _ := resourceData.Get("url").(string)
+	healthcheckURL, _ := healthcheck["url"].(string)
+	parsedApp, err := url.Parse(appURL)
+	if err != nil || appURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(healthcheckURL)
+	if err != nil {
+		return nil
+	}
+	var diags diag.Diagnostics
+	if urlPort(parsed) != urlPort(parsedApp) {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       "Healthcheck targets a different port than the app",
+			Detail:        fmt.Sprintf("The healthcheck url %q uses port %s, but the app url %q uses port %s. The app may never be reported as healthy.", healthcheckURL, urlPort(parsed), appURL, urlPort(parsedApp)),
+			AttributePath: cty.GetAttrPath("healthcheck"),
+		})
+	}
+	if !strings.HasPrefix(parsed.Path, strings.TrimSuffix(parsedApp.Path, "/")) {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       "Healthcheck path is outside of the app path",
+			Detail:        fmt.Sprintf("The healthcheck url %q is not under the app path %q.", healthcheckURL, parsedApp.Path),
+			AttributePath: cty.GetAttrPath("healthcheck"),
+		})
+	}
+	return diags
+}
+
+// appHealthcheck returns the healthcheck block of a "coder_app", if set.
+func appHealthcheck(raw interface{}) (map[string]interface{}, bool) {
+	set, ok := raw.(*schema.Set)
+	if !ok || set.Len() == 0 {
+		return nil, false
+	}
+	healthcheck, ok := set.List()[0].(map[string]interface{})
+	return healthcheck, ok
+}
+
+// urlPort returns the port of u, falling back to the default port of its
+// scheme.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// appLabel returns a human-readable name for a "coder_app" resource to use in
+// diagnostics, preferring the display name over the URL or command.
+func appLabel(rd *schema.ResourceDiff) string {
+	for _, key := range []string{"display_name", "name", "url", "command"} {
+		if value, _ := rd.Get(key).(string); value != "" {
+			return value
+		}
+	}
+	slug, _ := rd.Get("slug").(string)
+	return slug
+}
+
+var appURLPlaceholderRegex = regexp.MustCompile(`\{\{\s*([a-z_.]+)\s*\}\}`)
+
+const appURLPlaceholderList = `"{{workspace.id}}", "{{workspace.name}}", "{{workspace_owner.id}}", ` +
+	`"{{workspace_owner.name}}", "{{workspace_owner.full_name}}" and "{{workspace_owner.email}}"`
+
+// appURLPlaceholders returns the values of the placeholders external app urls
+// may contain, with the same defaults as the data sources they mirror.
+func appURLPlaceholders(env environment) map[string]string {
+	withDefault := func(name, fallback string) string {
+		if value := env.Get(name); value != "" {
+			return value
+		}
+		return fallback
+	}
+	return map[string]string{
+		"workspace.id":              workspaceID(env),
+		"workspace.name":            withDefault("CODER_WORKSPACE_NAME", "default"),
+		"workspace_owner.id":        withDefault("CODER_WORKSPACE_OWNER_ID", uuid.Nil.String()),
+		"workspace_owner.name":      withDefault("CODER_WORKSPACE_OWNER", "default"),
+		"workspace_owner.full_name": withDefault("CODER_WORKSPACE_OWNER_NAME", "default"),
+		"workspace_owner.email":     withDefault("CODER_WORKSPACE_OWNER_EMAIL", "default@example.com"),
+	}
+}
+
+// planAppURL plans the configured "url", with placeholders replaced for
+// external apps.
+func planAppURL(rd *schema.ResourceDiff, env environment) error {
+	configured := rd.GetRawConfig().GetAttr("url")
+	if !configured.IsKnown() || !rd.NewValueKnown("external") {
+		return nil
+	}
+	appURL := valueAsString(configured)
+	if external, _ := rd.Get("external").(bool); external {
+		placeholders := appURLPlaceholders(env)
+		var unknown []string
+		appURL = appURLPlaceholderRegex.ReplaceAllStringFunc(appURL, func(match string) string {
+			name := appURLPlaceholderRegex.FindStringSubmatch(match)[1]
+			value, ok := placeholders[name]
+			if !ok {
+				unknown = append(unknown, match)
+				return match
+			}
+			// Spaces are escaped as "%20" so the value works in both the
+			// path and the query.
+			return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+		})
+		if len(unknown) > 0 {
+			return xerrors.Errorf("unknown placeholder %q in url, must be one of %s", unknown[0], appURLPlaceholderList)
+		}
+	}
+	return rd.SetNew("url", appURL)
+}
@@ -61,6 +61,7 @@ func TestApp(t *testing.T) {
 						// Should be set by default even though it isn't
 						// specified.
 						"share",
+						"cors_behavior",
 						"url",
 						"healthcheck.0.url",
 						"healthcheck.0.interval",
@@ -148,6 +149,279 @@ func TestApp(t *testing.T) {
 		}
 	})
 
+	t.Run("DuplicateSlug", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			name        string
+			config      string
+			expectError *regexp.Regexp
+		}{{
+			name: "SameAgent",
+			config: `
+			provider "coder" {}
+			resource "coder_agent" "dev" {
+				os = "linux"
+				arch = "amd64"
+			}
+			resource "coder_app" "first" {
+				agent_id = coder_agent.dev.id
+				slug = "code-server"
+				display_name = "First"
+				url = "http://localhost:13337"
+			}
+			resource "coder_app" "second" {
+				agent_id = coder_agent.dev.id
+				slug = "code-server"
+				display_name = "Second"
+				url = "http://localhost:13338"
+			}
+			`,
+			expectError: regexp.MustCompile(`duplicate coder_app slug "code-server" on agent`),
+		}, {
+			name: "DifferentAgents",
+			config: `
+			provider "coder" {}
+			resource "coder_agent" "dev" {
+				os = "linux"
+				arch = "amd64"
+			}
+			resource "coder_agent" "other" {
+				os = "linux"
+				arch = "amd64"
+			}
+			resource "coder_app" "first" {
+				agent_id = coder_agent.dev.id
+				slug = "code-server"
+				url = "http://localhost:13337"
+			}
+			resource "coder_app" "second" {
+				agent_id = coder_agent.other.id
+				slug = "code-server"
+				url = "http://localhost:13337"
+			}
+			`,
+		}}
+		for _, tc := range cases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				resource.Test(t, resource.TestCase{
+					Providers: map[string]*schema.Provider{
+						"coder": provider.New(),
+					},
+					IsUnitTest: true,
+					Steps: []resource.TestStep{{
+						Config:      tc.config,
+						ExpectError: tc.expectError,
+					}},
+				})
+			})
+		}
+	})
+
+	t.Run("Icon", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			name        string
+			accessURL   string
+			icon        string
+			expectIcon  string
+			expectError *regexp.Regexp
+		}{{
+			name: "Path",
+			icon: "/icon/code.svg",
+		}, {
+			name: "HTTPS",
+			icon: "https://example.com/code.svg",
+		}, {
+			name: "DataURI",
+			icon: "data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=",
+		}, {
+			name:       "Builtin",
+			icon:       "builtin:jupyter",
+			expectIcon: "/icon/jupyter.svg",
+		}, {
+			name:       "BuiltinUnknown",
+			icon:       "builtin:does-not-exist",
+			expectIcon: "/icon/does-not-exist.svg",
+		}, {
+			name:        "HTTP",
+			icon:        "http://example.com/code.svg",
+			expectError: regexp.MustCompile(`http:// icons are blocked`),
+		}, {
+			name:      "HTTPAccessURL",
+			accessURL: "http://coder.internal:3000",
+			icon:      "http://coder.internal:3000/icon/code.svg",
+		}, {
+			name:        "Relative",
+			icon:        "icon/code.svg",
+			expectError: regexp.MustCompile(`invalid icon "icon/code.svg"`),
+		}, {
+			name:        "DataURINotImage",
+			icon:        "data:text/plain,hello",
+			expectError: regexp.MustCompile(`data URIs must contain an image`),
+		}}
+		for _, tc := range cases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				accessURL := tc.accessURL
+				if accessURL == "" {
+					accessURL = "https://mydeployment.coder.com"
+				}
+				expectIcon := tc.expectIcon
+				if expectIcon == "" {
+					expectIcon = tc.icon
+				}
+				var check resource.TestCheckFunc
+				if tc.expectError == nil {
+					check = func(state *terraform.State) error {
+						require.Len(t, state.Modules, 1)
+						app := state.Modules[0].Resources["coder_app.test"]
+						require.NotNil(t, app)
+						require.Equal(t, expectIcon, app.Primary.Attributes["icon"])
+						return nil
+					}
+				}
+				resource.Test(t, resource.TestCase{
+					Providers: map[string]*schema.Provider{
+						"coder": provider.New(),
+					},
+					IsUnitTest: true,
+					Steps: []resource.TestStep{{
+						Config: fmt.Sprintf(`
+						provider "coder" {
+							url = %q
+						}
+						resource "coder_agent" "dev" {
+							os = "linux"
+							arch = "amd64"
+						}
+						resource "coder_app" "test" {
+							agent_id = coder_agent.dev.id
+							slug = "test"
+							icon = %q
+							url = "http://localhost:13337"
+						}
+						`, accessURL, tc.icon),
+						Check:       check,
+						ExpectError: tc.expectError,
+					}},
+				})
+			})
+		}
+	})
+
+	t.Run("Healthcheck", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			name        string
+			url         string
+			healthcheck string
+			expectError *regexp.Regexp
+		}{{
+			name:        "Localhost",
+			url:         "http://localhost:13337",
+			healthcheck: "http://127.0.0.1:13337/healthz",
+		}, {
+			name:        "SameHostAsApp",
+			url:         "http://code-server:13337",
+			healthcheck: "http://code-server:13337/healthz",
+		}, {
+			name:        "Sidecar",
+			url:         "http://localhost:13337",
+			healthcheck: "http://10.0.0.12:13337/healthz",
+		}, {
+			name:        "NetworkAlias",
+			url:         "http://localhost:13337",
+			healthcheck: "http://jupyter:8888/api",
+		}, {
+			name:        "PublicAddress",
+			url:         "http://localhost:13337",
+			healthcheck: "http://8.8.8.8/healthz",
+			expectError: regexp.MustCompile(`must target localhost or the host of the app url`),
+		}, {
+			name:        "InvalidScheme",
+			url:         "http://localhost:13337",
+			healthcheck: "tcp://localhost:13337",
+			expectError: regexp.MustCompile(`scheme must be "http" or "https"`),
+		}, {
+			name:        "RemoteHost",
+			url:         "http://localhost:13337",
+			healthcheck: "https://example.com/healthz",
+			expectError: regexp.MustCompile(`must target localhost or the host of the app url`),
+		}}
+		for _, tc := range cases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				resource.Test(t, resource.TestCase{
+					Providers: map[string]*schema.Provider{
+						"coder": provider.New(),
+					},
+					IsUnitTest: true,
+					Steps: []resource.TestStep{{
+						Config: fmt.Sprintf(`
+						provider "coder" {}
+						resource "coder_agent" "dev" {
+							os = "linux"
+							arch = "amd64"
+						}
+						resource "coder_app" "test" {
+							agent_id = coder_agent.dev.id
+							slug = "test"
+							url = %q
+							healthcheck {
+								url = %q
+								interval = 5
+								threshold = 6
+								verify = true
+							}
+						}
+						`, tc.url, tc.healthcheck),
+						ExpectError: tc.expectError,
+					}},
+				})
+			})
+		}
+	})
+
+	t.Run("HealthcheckUnknownAgent", func(t *testing.T) {
+		t.Parallel()
+		// The agent ID is unknown until the agent is created, which must
+		// not defer checking the healthcheck until apply.
+		resource.Test(t, resource.TestCase{
+			Providers: map[string]*schema.Provider{
+				"coder": provider.New(),
+			},
+			IsUnitTest: true,
+			Steps: []resource.TestStep{{
+				Config: `
+				provider "coder" {}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_app" "test" {
+					agent_id = coder_agent.dev.id
+					slug = "test"
+					url = "http://localhost:13337"
+					healthcheck {
+						url = "https://example.com/healthz"
+						interval = 5
+						threshold = 6
+					}
+				}
+				`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`must target localhost or the host of the app url`),
+			}},
+		})
+	})
+
 	t.Run("SharingLevel", func(t *testing.T) {
 		t.Parallel()
 
@@ -172,6 +446,11 @@ func TestApp(t *testing.T) {
 				value:       "owner",
 				expectValue: "owner",
 			},
+			{
+				name:        "ExplicitOrganization",
+				value:       "organization",
+				expectValue: "organization",
+			},
 			{
 				name:        "ExplicitAuthenticated",
 				value:       "authenticated",
@@ -247,3 +526,271 @@ func TestApp(t *testing.T) {
 		}
 	})
 }
+
+func TestAppURLPlaceholders(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_NAME", "dev")
+	t.Setenv("CODER_WORKSPACE_OWNER", "jdoe")
+	t.Setenv("CODER_WORKSPACE_OWNER_NAME", "Jane Doe")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_app" "grafana" {
+					agent_id = coder_agent.dev.id
+					slug = "grafana"
+					external = true
+					url = "https://grafana.example.com/d/home?var-user={{workspace_owner.name}}&var-workspace={{ workspace.name }}&author={{workspace_owner.full_name}}"
+				}
+				resource "coder_app" "internal" {
+					agent_id = coder_agent.dev.id
+					slug = "internal"
+					url = "http://localhost:8080/{{workspace.name}}"
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				grafana := state.Modules[0].Resources["coder_app.grafana"]
+				require.NotNil(t, grafana)
+				require.Equal(t, "https://grafana.example.com/d/home?var-user=jdoe&var-workspace=dev&author=Jane%20Doe", grafana.Primary.Attributes["url"])
+				// Only external urls are resolved.
+				internal := state.Modules[0].Resources["coder_app.internal"]
+				require.NotNil(t, internal)
+				require.Equal(t, "http://localhost:8080/{{workspace.name}}", internal.Primary.Attributes["url"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_app" "grafana" {
+					agent_id = coder_agent.dev.id
+					slug = "grafana"
+					external = true
+					url = "https://grafana.example.com/?user={{workspace_owner.nickname}}"
+				}
+				`,
+			ExpectError: regexp.MustCompile(`unknown placeholder "{{workspace_owner.nickname}}"`),
+		}},
+	})
+}
+
+func TestAppSubdomainOptions(t *testing.T) {
+	t.Parallel()
+	config := func(subdomain bool, ports string) string {
+		return fmt.Sprintf(`
+			provider "coder" {
+			}
+			resource "coder_agent" "dev" {
+				os = "linux"
+				arch = "amd64"
+			}
+			resource "coder_app" "jupyter" {
+				agent_id = coder_agent.dev.id
+				slug = "jupyter"
+				url = "http://localhost:8888"
+				subdomain = %t
+				path_prefix = "/lab"
+				additional_ports = %s
+			}
+			`, subdomain, ports)
+	}
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config(true, "[8889, 8890]"),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_app.jupyter"]
+				require.NotNil(t, resource)
+				require.Equal(t, "/lab", resource.Primary.Attributes["path_prefix"])
+				require.Equal(t, "2", resource.Primary.Attributes["additional_ports.#"])
+				require.Equal(t, "8889", resource.Primary.Attributes["additional_ports.0"])
+				require.Equal(t, "8890", resource.Primary.Attributes["additional_ports.1"])
+				return nil
+			},
+		}, {
+			Config:      config(false, "[8889]"),
+			ExpectError: regexp.MustCompile(`require "subdomain" to be true`),
+		}, {
+			Config:      config(true, "[8888]"),
+			ExpectError: regexp.MustCompile("already the port of the app url"),
+		}},
+	})
+}
+
+func TestAppDependsOnScript(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_script" "install" {
+					agent_id = coder_agent.dev.id
+					display_name = "Install code-server"
+					script = "curl -fsSL https://code-server.dev/install.sh | sh"
+					run_on_start = true
+				}
+				resource "coder_app" "code-server" {
+					agent_id = coder_agent.dev.id
+					slug = "code-server"
+					url = "http://localhost:13337"
+					depends_on_script = coder_script.install.id
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				script := state.Modules[0].Resources["coder_script.install"]
+				require.NotNil(t, script)
+				app := state.Modules[0].Resources["coder_app.code-server"]
+				require.NotNil(t, app)
+				require.Equal(t, script.Primary.ID, app.Primary.Attributes["depends_on_script"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestAppPreviewImage(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name        string
+		image       string
+		expectError *regexp.Regexp
+	}{{
+		name:  "HTTPS",
+		image: "https://example.com/preview.png",
+	}, {
+		name:  "DataURI",
+		image: "data:image/png;base64,iVBORw0KGgo=",
+	}, {
+		name:        "Builtin",
+		image:       "builtin:jupyter",
+		expectError: regexp.MustCompile("builtin icons can't be used as images"),
+	}, {
+		name:        "HTTP",
+		image:       "http://example.com/preview.png",
+		expectError: regexp.MustCompile("http:// icons are blocked"),
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			resource.Test(t, resource.TestCase{
+				Providers: map[string]*schema.Provider{
+					"coder": provider.New(),
+				},
+				IsUnitTest: true,
+				Steps: []resource.TestStep{{
+					Config: fmt.Sprintf(`
+					provider "coder" {}
+					resource "coder_agent" "dev" {
+						os = "linux"
+						arch = "amd64"
+					}
+					resource "coder_app" "test" {
+						agent_id = coder_agent.dev.id
+						slug = "test"
+						preview_image = %q
+						url = "http://localhost:13337"
+					}
+					`, tc.image),
+					ExpectError: tc.expectError,
+				}},
+			})
+		})
+	}
+}
+
+func TestAppLocales(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_app" "files" {
+					agent_id = coder_agent.dev.id
+					slug = "files"
+					display_name = "File Browser"
+					url = "http://localhost:8080"
+					locales {
+						locale = "de"
+						display_name = "Dateibrowser"
+						description = "Dateien im Workspace verwalten"
+					}
+					locales {
+						locale = "pt-BR"
+						display_name = "Navegador de arquivos"
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["coder_app.files"]
+				require.NotNil(t, resource)
+				attrs := resource.Primary.Attributes
+				require.Equal(t, "2", attrs["locales.#"])
+				require.Equal(t, "de", attrs["locales.0.locale"])
+				require.Equal(t, "Dateibrowser", attrs["locales.0.display_name"])
+				require.Equal(t, "Dateien im Workspace verwalten", attrs["locales.0.description"])
+				require.Equal(t, "pt-BR", attrs["locales.1.locale"])
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_app" "files" {
+					agent_id = coder_agent.dev.id
+					slug = "files"
+					url = "http://localhost:8080"
+					locales {
+						locale = "de"
+						display_name = "Dateibrowser"
+					}
+					locales {
+						locale = "DE"
+						display_name = "Dateien"
+					}
+				}
+				`,
+			ExpectError: regexp.MustCompile(`duplicate locale "DE"`),
+		}},
+	})
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func deploymentDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to get the settings of the Coder deployment that affect templates, such as " +
+			"whether it serves apps on subdomains.",
+		ReadContext: func(c context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			accessURL := config.URL.String()
+			rd.SetId(deterministicID("deployment", accessURL))
+			_ = rd.Set("access_url", accessURL)
+			_ = rd.Set("healthz_url", config.URL.JoinPath("healthz").String())
+
+			wildcardAccessURL := config.Env.Get("CODER_DEPLOYMENT_WILDCARD_ACCESS_URL")
+			_ = rd.Set("wildcard_access_url", wildcardAccessURL)
+			subdomainApps := wildcardAccessURL != ""
+			_ = rd.Set("subdomain_apps_enabled", subdomainApps)
+			_ = rd.Set("path_apps_enabled", config.Env.Get("CODER_DEPLOYMENT_DISABLE_PATH_APPS") != "true")
+
+			subdomainAppURLTemplate := ""
+			if subdomainApps {
+				host := strings.Replace(wildcardAccessURL, "*", "{app}--{agent}--{workspace}--{owner}", 1)
+				// The wildcard is a host, which is served on the port of the
+				// access URL.
+				if port := config.URL.Port(); port != "" && !strings.Contains(host, ":") {
+					host += ":" + port
+				}
+				subdomainAppURLTemplate = config.URL.Scheme + "://" + host + "/"
+			}
+			_ = rd.Set("subdomain_app_url_template", subdomainAppURLTemplate)
+
+			if require, _ := rd.Get("require_subdomain_apps").(bool); require && !subdomainApps {
+				return diag.Errorf("the template requires subdomain apps, but the deployment at %s has no wildcard access URL; "+
+					"ask an administrator to set CODER_WILDCARD_ACCESS_URL", accessURL)
+			}
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"require_subdomain_apps": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Fail the build if the deployment doesn't serve apps on subdomains, for templates with apps " +
+					"that don't work on a path, such as apps that require to be served from the root.",
+			},
+			"access_url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The access URL of the deployment.",
+			},
+			"healthz_url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The URL of the health endpoint of the deployment, for workspaces to wait for it to be reachable.",
+			},
+			"wildcard_access_url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The wildcard host apps are served on, such as \"*.coder.example.com\". Empty if the deployment doesn't have one.",
+			},
+			"subdomain_apps_enabled": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the deployment can serve apps with \"subdomain\" set, which requires a wildcard access URL.",
+			},
+			"path_apps_enabled": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the deployment serves apps on a path of the access URL. Administrators can disable this for security.",
+			},
+			"subdomain_app_url_template": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The URL of a subdomain app, with the placeholders `{app}`, `{agent}`, `{workspace}` and `{owner}` " +
+					"for the app slug, agent name, workspace name and owner's username. Use `replace()` to fill them in. " +
+					"Empty if subdomain apps aren't enabled.",
+			},
+		},
+	}
+}
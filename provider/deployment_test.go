@@ -0,0 +1,84 @@
+package provider_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/terraform-provider-coder/provider"
+)
+
+func TestDeployment(t *testing.T) {
+	t.Setenv("CODER_DEPLOYMENT_WILDCARD_ACCESS_URL", "*.apps.example.com")
+	t.Setenv("CODER_DEPLOYMENT_DISABLE_PATH_APPS", "true")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+				url = "https://example.com:8443"
+			}
+			data "coder_deployment" "me" {
+				require_subdomain_apps = true
+			}`,
+			Check: func(state *terraform.State) error {
+				resource := state.Modules[0].Resources["data.coder_deployment.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "https://example.com:8443", attribs["access_url"])
+				require.Equal(t, "https://example.com:8443/healthz", attribs["healthz_url"])
+				require.Equal(t, "*.apps.example.com", attribs["wildcard_access_url"])
+				require.Equal(t, "true", attribs["subdomain_apps_enabled"])
+				require.Equal(t, "false", attribs["path_apps_enabled"])
+				require.Equal(t, "https://{app}--{agent}--{workspace}--{owner}.apps.example.com:8443/", attribs["subdomain_app_url_template"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestDeploymentWithoutWildcard(t *testing.T) {
+	t.Setenv("CODER_DEPLOYMENT_WILDCARD_ACCESS_URL", "")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+				url = "https://example.com"
+			}
+			data "coder_deployment" "me" {}`,
+			Check: func(state *terraform.State) error {
+				resource := state.Modules[0].Resources["data.coder_deployment.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "false", attribs["subdomain_apps_enabled"])
+				require.Equal(t, "true", attribs["path_apps_enabled"])
+				require.Empty(t, attribs["subdomain_app_url_template"])
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {
+				url = "https://example.com"
+			}
+			data "coder_deployment" "me" {
+				require_subdomain_apps = true
+			}`,
+			ExpectError: regexp.MustCompile("the template requires subdomain apps"),
+		}},
+	})
+}
@@ -2,24 +2,134 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
 )
 
+// envNameRegex matches POSIX-compliant environment variable names.
+var envNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedEnvPrefix is the prefix of environment variables set by Coder
+// itself, such as CODER_AGENT_TOKEN.
+const reservedEnvPrefix = "CODER_"
+
+// validateEnvName ensures name does not accidentally override a variable set
+// by Coder. allowReservedKey is the attribute of the resource that allows
+// overriding them.
+func validateEnvName(name string, allowReserved bool, allowReservedKey string) error {
+	// Windows treats environment variable names case-insensitively.
+	if !allowReserved && strings.HasPrefix(strings.ToUpper(name), reservedEnvPrefix) {
+		return xerrors.Errorf("%q uses the reserved %q prefix; set %s to override variables set by Coder", name, reservedEnvPrefix, allowReservedKey)
+	}
+	return nil
+}
+
+// warnEnvNames is a ValidateDiagFunc for an environment variable name or a
+// map of variables. Names that aren't POSIX-compliant are only a warning: the
+// agent sets them as-is, but most shells can't expand them.
+func warnEnvNames(v interface{}, path cty.Path) diag.Diagnostics {
+	paths := map[string]cty.Path{}
+	switch v := v.(type) {
+	case string:
+		paths[v] = path
+	case map[string]interface{}:
+		for name := range v {
+			paths[name] = path.IndexString(name)
+		}
+	default:
+		return diag.Errorf("expected string or map, got %T", v)
+	}
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diags diag.Diagnostics
+	for _, name := range names {
+		if envNameRegex.MatchString(name) {
+			continue
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       "Environment variable name isn't POSIX-compliant",
+			Detail:        fmt.Sprintf("%q contains characters other than letters, digits and underscores, or starts with a digit. The agent sets it, but most shells can't expand it.", name),
+			AttributePath: paths[name],
+		})
+	}
+	return diags
+}
+
+// envOverrides sets "overrides" for a "coder_env" being created, and warns
+// about the variables it collides with. The agent's env is only known when
+// the agent was read or created by this provider instance.
+func envOverrides(rd *schema.ResourceData, config config) diag.Diagnostics {
+	agentID, _ := rd.Get("agent_id").(string)
+	name, _ := rd.Get("name").(string)
+	appSlug, _ := rd.Get("app_slug").(string)
+	var diags diag.Diagnostics
+	overrides := ""
+	if stored, ok := config.AgentEnv.Load(agentID); ok {
+		agentEnv, _ := stored.(map[string]interface{})
+		if _, ok := agentEnv[name]; ok {
+			overrides = "coder_agent"
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Warning,
+				Summary:       "Environment variable overrides the agent env",
+				Detail:        fmt.Sprintf("%q is also set by the \"env\" of the coder_agent %q. The value of the coder_env takes precedence.", name, agentID),
+				AttributePath: cty.GetAttrPath("name"),
+			})
+		}
+	}
+	// Variables scoped to different apps don't collide.
+	if existing, ok := config.EnvNames.claim(agentID, appSlug+"/"+name, rd.Id()); !ok {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       "Environment variable is set more than once",
+			Detail:        fmt.Sprintf("%q is set by more than one coder_env on the agent %q (%s and %s). Only one of the values is used.", name, agentID, existing, rd.Id()),
+			AttributePath: cty.GetAttrPath("name"),
+		})
+	}
+	err := rd.Set("overrides", overrides)
+	if err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	return diags
+}
+
 func envResource() *schema.Resource {
 	return &schema.Resource{
-		Description: `Use this resource to set an environment variable in a workspace. Note that this resource cannot be used to overwrite existing environment variables set on the "coder_agent" resource.`,
-		CreateContext: func(_ context.Context, rd *schema.ResourceData, _ interface{}) diag.Diagnostics {
+		Description: "Use this resource to set an environment variable in a workspace. Variables are applied in order of " +
+			`precedence, lowest first: the variables injected by Coder, the "env" of the "coder_agent", "coder_env" ` +
+			"resources, and finally variables the user sets in their session, such as in their dotfiles. A warning is " +
+			"shown when a variable overrides another from the template.",
+		CreateContext: func(_ context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
 			rd.SetId(uuid.NewString())
-
-			return nil
+			return envOverrides(rd, config)
 		},
 		ReadContext:   schema.NoopContext,
 		DeleteContext: schema.NoopContext,
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			if !rd.NewValueKnown("name") {
+				return nil
+			}
+			name, _ := rd.Get("name").(string)
+			allowReserved, _ := rd.Get("allow_reserved_name").(bool)
+			return validateEnvName(name, allowReserved, "allow_reserved_name")
+		},
 		Schema: map[string]*schema.Schema{
 			"agent_id": {
 				Type:        schema.TypeString,
@@ -28,14 +138,26 @@ func envResource() *schema.Resource {
 				Required:    true,
 			},
 			"name": {
-				Type:        schema.TypeString,
-				Description: "The name of the environment variable.",
+				Type:             schema.TypeString,
+				Description:      "The name of the environment variable.",
+				ForceNew:         true,
+				Required:         true,
+				ValidateDiagFunc: warnEnvNames,
+			},
+			"allow_reserved_name": {
+				Type:        schema.TypeBool,
+				Description: "Allow the name to start with \"CODER_\", overriding a variable set by Coder. Only use this if you know what you are doing.",
 				ForceNew:    true,
-				Required:    true,
-				ValidateFunc: validation.StringMatch(
-					regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`),
-					"must be a valid environment variable name",
-				),
+				Optional:    true,
+				Default:     false,
+			},
+			"app_slug": {
+				Type: schema.TypeString,
+				Description: `The "slug" of a "coder_app" on the same agent. The variable is only set in sessions of ` +
+					"that app, such as a DISPLAY for a GUI app, instead of in every session on the agent.",
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validation.StringMatch(appSlugRegex, "must be the slug of a coder_app"),
 			},
 			"value": {
 				Type:        schema.TypeString,
@@ -43,6 +165,11 @@ func envResource() *schema.Resource {
 				ForceNew:    true,
 				Optional:    true,
 			},
+			"overrides": {
+				Type:        schema.TypeString,
+				Description: `"coder_agent" when the variable overrides the "env" of the agent, otherwise empty.`,
+				Computed:    true,
+			},
 		},
 	}
 }
@@ -85,9 +85,10 @@ func TestEnvEmptyValue(t *testing.T) {
 	})
 }
 
-func TestEnvBadName(t *testing.T) {
+func TestEnvNonPOSIXName(t *testing.T) {
 	t.Parallel()
 
+	// Names that aren't POSIX-compliant are only a warning.
 	resource.Test(t, resource.TestCase{
 		Providers: map[string]*schema.Provider{
 			"coder": provider.New(),
@@ -102,7 +103,14 @@ func TestEnvBadName(t *testing.T) {
 				name = "bad-name"
 			}
 			`,
-			ExpectError: regexp.MustCompile(`must be a valid environment variable name`),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["coder_env.example"]
+				require.NotNil(t, resource)
+				require.Equal(t, "bad-name", resource.Primary.Attributes["name"])
+				return nil
+			},
 		}},
 	})
 }
@@ -127,3 +135,131 @@ func TestEnvNoName(t *testing.T) {
 		}},
 	})
 }
+
+func TestEnvReservedName(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_env" "example" {
+				agent_id = "king"
+				name = "CODER_AGENT_URL"
+				value = "https://example.com"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`"CODER_AGENT_URL" uses the reserved "CODER_" prefix; set allow_reserved_name`),
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_env" "example" {
+				agent_id = "king"
+				name = "CODER_AGENT_URL"
+				value = "https://example.com"
+				allow_reserved_name = true
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				env := state.Modules[0].Resources["coder_env.example"]
+				require.NotNil(t, env)
+				require.Equal(t, "CODER_AGENT_URL", env.Primary.Attributes["name"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestEnvAppSlug(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_env" "example" {
+				agent_id = "king"
+				name = "DISPLAY"
+				value = ":1"
+				app_slug = "desktop"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				env := state.Modules[0].Resources["coder_env.example"]
+				require.NotNil(t, env)
+				require.Equal(t, "desktop", env.Primary.Attributes["app_slug"])
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_env" "example" {
+				agent_id = "king"
+				name = "DISPLAY"
+				value = ":1"
+				app_slug = "Not A Slug"
+			}
+			`,
+			ExpectError: regexp.MustCompile("must be the slug of a coder_app"),
+		}},
+	})
+}
+
+func TestEnvOverridesAgentEnv(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_agent" "dev" {
+				os = "linux"
+				arch = "amd64"
+				env = {
+					EDITOR = "vim"
+				}
+			}
+			resource "coder_env" "editor" {
+				agent_id = coder_agent.dev.id
+				name = "EDITOR"
+				value = "nano"
+			}
+			resource "coder_env" "pager" {
+				agent_id = coder_agent.dev.id
+				name = "PAGER"
+				value = "less"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				editor := state.Modules[0].Resources["coder_env.editor"]
+				require.NotNil(t, editor)
+				require.Equal(t, "coder_agent", editor.Primary.Attributes["overrides"])
+				pager := state.Modules[0].Resources["coder_env.pager"]
+				require.NotNil(t, pager)
+				require.Equal(t, "", pager.Primary.Attributes["overrides"])
+				return nil
+			},
+		}},
+	})
+}
@@ -16,6 +16,7 @@ func TestExamples(t *testing.T) {
 
 	for _, testDir := range []string{
 		"coder_parameter",
+		"coder_task",
 		"coder_workspace_tags",
 	} {
 		t.Run(testDir, func(t *testing.T) {
@@ -3,10 +3,12 @@ package provider
 import (
 	"context"
 	"fmt"
-	"os"
+	"reflect"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 // externalAuthDataSource returns a schema for an external authentication data source.
@@ -14,14 +16,37 @@ func externalAuthDataSource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this data source to require users to authenticate with an external service prior to workspace creation. This can be used to pre-authenticate external services in a workspace. (e.g. gcloud, gh, docker, etc)",
 		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
 			id, ok := rd.Get("id").(string)
 			if !ok || id == "" {
 				return diag.Errorf("id is required")
 			}
 			rd.SetId(id)
 
-			accessToken := os.Getenv(ExternalAuthAccessTokenEnvironmentVariable(id))
+			accessToken := config.Env.Get(ExternalAuthAccessTokenEnvironmentVariable(id))
 			rd.Set("access_token", accessToken)
+
+			expiresAt := config.Env.Get(ExternalAuthExpiresAtEnvironmentVariable(id))
+			rd.Set("expires_at", expiresAt)
+			minValidity, _ := rd.Get("min_validity").(int)
+			if expiresAt != "" && minValidity > 0 {
+				expiry, err := time.Parse(time.RFC3339, expiresAt)
+				if err != nil {
+					return diag.Errorf("parse expiry of external auth %q: %s", id, err)
+				}
+				if time.Until(expiry) < time.Duration(minValidity)*time.Second {
+					return diag.Errorf("the access token of external auth %q expires at %s, which is within min_validity (%d seconds); re-authenticate with the provider and retry the build", id, expiresAt, minValidity)
+				}
+			}
+
+			installationToken := config.Env.Get(ExternalAuthInstallationTokenEnvironmentVariable(id))
+			rd.Set("installation_token", installationToken)
+			installationID := config.Env.Get(ExternalAuthInstallationIDEnvironmentVariable(id))
+			rd.Set("installation_id", installationID)
 			return nil
 		},
 		Schema: map[string]*schema.Schema{
@@ -35,6 +60,29 @@ func externalAuthDataSource() *schema.Resource {
 				Description: "The access token returned by the external auth provider. This can be used to pre-authenticate command-line tools.",
 				Computed:    true,
 			},
+			"expires_at": {
+				Type:        schema.TypeString,
+				Description: "When \"access_token\" expires, as an RFC 3339 timestamp. Coder refreshes the token before the build starts, so this reflects the freshest token available. Empty if the token doesn't expire.",
+				Computed:    true,
+			},
+			"min_validity": {
+				Type:         schema.TypeInt,
+				Description:  "Fail the build if \"access_token\" expires within this many seconds, so long builds don't fail half-way through on an expired token. Defaults to 0, which disables the check.",
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"installation_token": {
+				Type:        schema.TypeString,
+				Description: "A short-lived installation token for external auth providers backed by a GitHub App. Unlike \"access_token\", it acts as the app installation rather than the user, so it can clone repositories of the organization the app is installed in. Empty for other providers.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"installation_id": {
+				Type:        schema.TypeString,
+				Description: "The ID of the GitHub App installation \"installation_token\" was issued for. Empty for other providers.",
+				Computed:    true,
+			},
 			"optional": {
 				Type:        schema.TypeBool,
 				Description: "Authenticating with the external auth provider is not required, and can be skipped by users when creating or updating workspaces",
@@ -47,3 +95,15 @@ func externalAuthDataSource() *schema.Resource {
 func ExternalAuthAccessTokenEnvironmentVariable(id string) string {
 	return fmt.Sprintf("CODER_EXTERNAL_AUTH_ACCESS_TOKEN_%s", id)
 }
+
+func ExternalAuthInstallationTokenEnvironmentVariable(id string) string {
+	return fmt.Sprintf("CODER_EXTERNAL_AUTH_INSTALLATION_TOKEN_%s", id)
+}
+
+func ExternalAuthInstallationIDEnvironmentVariable(id string) string {
+	return fmt.Sprintf("CODER_EXTERNAL_AUTH_INSTALLATION_ID_%s", id)
+}
+
+func ExternalAuthExpiresAtEnvironmentVariable(id string) string {
+	return fmt.Sprintf("CODER_EXTERNAL_AUTH_EXPIRES_AT_%s", id)
+}
@@ -1,7 +1,9 @@
 package provider_test
 
 import (
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/coder/terraform-provider-coder/provider"
 
@@ -76,3 +78,83 @@ func TestOptionalExternalAuth(t *testing.T) {
 		}},
 	})
 }
+
+func TestExternalAuthGitHubApp(t *testing.T) {
+	t.Setenv(provider.ExternalAuthAccessTokenEnvironmentVariable("github-app"), "ghu_user")
+	t.Setenv(provider.ExternalAuthInstallationTokenEnvironmentVariable("github-app"), "ghs_installation")
+	t.Setenv(provider.ExternalAuthInstallationIDEnvironmentVariable("github-app"), "12345")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_external_auth" "github" {
+				id = "github-app"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_external_auth.github"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "ghu_user", attribs["access_token"])
+				require.Equal(t, "ghs_installation", attribs["installation_token"])
+				require.Equal(t, "12345", attribs["installation_id"])
+
+				return nil
+			},
+		}},
+	})
+}
+
+func TestExternalAuthExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute).UTC().Format(time.RFC3339)
+	t.Setenv(provider.ExternalAuthAccessTokenEnvironmentVariable("github"), "gho_token")
+	t.Setenv(provider.ExternalAuthExpiresAtEnvironmentVariable("github"), expiresAt)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_external_auth" "github" {
+				id = "github"
+				min_validity = 300
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_external_auth.github"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, expiresAt, attribs["expires_at"])
+				require.Equal(t, "300", attribs["min_validity"])
+
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			data "coder_external_auth" "github" {
+				id = "github"
+				min_validity = 3600
+			}
+			`,
+			ExpectError: regexp.MustCompile(`which is within min_validity \(3600 seconds\)`),
+		}},
+	})
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func gcpWorkloadIdentityDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to configure GCP workload identity federation with the workspace owner's " +
+			"OpenID Connect identity. Write \"subject_token\" to \"token_file_path\" and \"credential_config\" to the " +
+			"file referenced by GOOGLE_APPLICATION_CREDENTIALS in the workspace for per-user, keyless access to GCP APIs.",
+		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			rd.SetId(uuid.NewString())
+
+			projectNumber, _ := rd.Get("project_number").(string)
+			poolID, _ := rd.Get("pool_id").(string)
+			providerID, _ := rd.Get("provider_id").(string)
+			audience := fmt.Sprintf("//iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/providers/%s", projectNumber, poolID, providerID)
+			_ = rd.Set("audience", audience)
+
+			tokenPath, _ := rd.Get("token_file_path").(string)
+			credentials := map[string]interface{}{
+				"type":               "external_account",
+				"audience":           audience,
+				"subject_token_type": "urn:ietf:params:oauth:token-type:id_token",
+				"token_url":          "https://sts.googleapis.com/v1/token",
+				"credential_source": map[string]interface{}{
+					"file": tokenPath,
+				},
+			}
+			if serviceAccount, _ := rd.Get("service_account_email").(string); serviceAccount != "" {
+				credentials["service_account_impersonation_url"] = fmt.Sprintf("https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken", serviceAccount)
+			}
+			credentialConfig, err := json.Marshal(credentials)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			_ = rd.Set("credential_config", string(credentialConfig))
+			_ = rd.Set("subject_token", config.Env.Get("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN"))
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"project_number": {
+				Type:         schema.TypeString,
+				Description:  "The number of the GCP project the workload identity pool belongs to.",
+				Required:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[0-9]+$`), "must be a project number, not a project ID"),
+			},
+			"pool_id": {
+				Type:        schema.TypeString,
+				Description: "The ID of the workload identity pool.",
+				Required:    true,
+			},
+			"provider_id": {
+				Type:        schema.TypeString,
+				Description: "The ID of the OpenID Connect provider in the workload identity pool that trusts the identity provider Coder authenticates users with.",
+				Required:    true,
+			},
+			"service_account_email": {
+				Type:        schema.TypeString,
+				Description: "The email of a service account to impersonate. Leave empty to access GCP APIs with the federated identity directly.",
+				Optional:    true,
+			},
+			"token_file_path": {
+				Type:        schema.TypeString,
+				Description: `The path in the workspace "subject_token" is written to.`,
+				Optional:    true,
+				Default:     "/var/run/secrets/coder/oidc-token",
+			},
+			"audience": {
+				Type:        schema.TypeString,
+				Description: "The audience of the workload identity pool provider, as expected by the Security Token Service.",
+				Computed:    true,
+			},
+			"credential_config": {
+				Type:        schema.TypeString,
+				Description: "A JSON encoded external account credential configuration that reads the token from \"token_file_path\".",
+				Computed:    true,
+			},
+			"subject_token": {
+				Type:        schema.TypeString,
+				Description: "The OpenID Connect ID token of the workspace owner to exchange for GCP credentials. Empty if the owner didn't authenticate with OpenID Connect.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coder/terraform-provider-coder/provider"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCPWorkloadIdentity(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN", "id-token")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_gcp_workload_identity" "me" {
+				project_number = "123456789"
+				pool_id = "coder"
+				provider_id = "okta"
+				service_account_email = "workspaces@example.iam.gserviceaccount.com"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_gcp_workload_identity.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				audience := "//iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/coder/providers/okta"
+				require.Equal(t, audience, attribs["audience"])
+				require.Equal(t, "id-token", attribs["subject_token"])
+
+				var config map[string]interface{}
+				err := json.Unmarshal([]byte(attribs["credential_config"]), &config)
+				require.NoError(t, err)
+				require.Equal(t, "external_account", config["type"])
+				require.Equal(t, audience, config["audience"])
+				require.Equal(t, map[string]interface{}{"file": "/var/run/secrets/coder/oidc-token"}, config["credential_source"])
+				require.Equal(t, "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/workspaces@example.iam.gserviceaccount.com:generateAccessToken", config["service_account_impersonation_url"])
+				return nil
+			},
+		}},
+	})
+}
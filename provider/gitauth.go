@@ -3,7 +3,7 @@ package provider
 import (
 	"context"
 	"fmt"
-	"os"
+	"reflect"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -15,6 +15,11 @@ func gitAuthDataSource() *schema.Resource {
 		DeprecationMessage: "Use the `coder_external_auth` data source instead.",
 		Description:        "Use this data source to require users to authenticate with a Git provider prior to workspace creation. This can be used to perform an authenticated `git clone` in startup scripts.",
 		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
 			rawID, ok := rd.GetOk("id")
 			if !ok {
 				return diag.Errorf("id is required")
@@ -25,7 +30,7 @@ func gitAuthDataSource() *schema.Resource {
 			}
 			rd.SetId(id)
 
-			accessToken := os.Getenv(GitAuthAccessTokenEnvironmentVariable(id))
+			accessToken := config.Env.Get(GitAuthAccessTokenEnvironmentVariable(id))
 			rd.Set("access_token", accessToken)
 
 			return nil
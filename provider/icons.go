@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// BuiltinIcons maps the names of icons bundled with the Coder dashboard to
+// their paths. See https://github.com/coder/coder/tree/main/site/static/icon.
+//
+// This list is duplicated from the Coder source code, so make sure to update
+// it when icons are added or renamed there.
+var BuiltinIcons = map[string]string{
+	"apple-black": "/icon/apple-black.svg",
+	"apple-grey":  "/icon/apple-grey.svg",
+	"aws":         "/icon/aws.svg",
+	"azure":       "/icon/azure.png",
+	"centos":      "/icon/centos.svg",
+	"cloud":       "/icon/cloud.svg",
+	"code":        "/icon/code.svg",
+	"coder":       "/icon/coder.svg",
+	"conda":       "/icon/conda.svg",
+	"confluence":  "/icon/confluence.svg",
+	"container":   "/icon/container.svg",
+	"cpp":         "/icon/cpp.svg",
+	"database":    "/icon/database.svg",
+	"datagrip":    "/icon/datagrip.svg",
+	"dataspell":   "/icon/dataspell.svg",
+	"debian":      "/icon/debian.svg",
+	"desktop":     "/icon/desktop.svg",
+	"discord":     "/icon/discord.svg",
+	"docker":      "/icon/docker.png",
+	"dotfiles":    "/icon/dotfiles.svg",
+	"dotnet":      "/icon/dotnet.svg",
+	"fedora":      "/icon/fedora.svg",
+	"filebrowser": "/icon/filebrowser.svg",
+	"fleet":       "/icon/fleet.svg",
+	"folder":      "/icon/folder.svg",
+	"gateway":     "/icon/gateway.svg",
+	"gcp":         "/icon/gcp.png",
+	"git":         "/icon/git.svg",
+	"github":      "/icon/github.svg",
+	"gitlab":      "/icon/gitlab.svg",
+	"go":          "/icon/go.svg",
+	"goland":      "/icon/goland.svg",
+	"image":       "/icon/image.svg",
+	"intellij":    "/icon/intellij.svg",
+	"java":        "/icon/java.svg",
+	"jupyter":     "/icon/jupyter.svg",
+	"k8s":         "/icon/k8s.png",
+	"kasmvnc":     "/icon/kasmvnc.svg",
+	"kotlin":      "/icon/kotlin.svg",
+	"matlab":      "/icon/matlab.svg",
+	"memory":      "/icon/memory.svg",
+	"nix":         "/icon/nix.svg",
+	"node":        "/icon/node.svg",
+	"nomad":       "/icon/nomad.svg",
+	"novnc":       "/icon/novnc.svg",
+	"php":         "/icon/php.svg",
+	"phpstorm":    "/icon/phpstorm.svg",
+	"postgres":    "/icon/postgres.svg",
+	"pycharm":     "/icon/pycharm.svg",
+	"python":      "/icon/python.svg",
+	"pytorch":     "/icon/pytorch.svg",
+	"rdp":         "/icon/rdp.svg",
+	"redhat":      "/icon/redhat.svg",
+	"rider":       "/icon/rider.svg",
+	"rockylinux":  "/icon/rockylinux.svg",
+	"rstudio":     "/icon/rstudio.svg",
+	"rubymine":    "/icon/rubymine.svg",
+	"rust":        "/icon/rust.svg",
+	"slack":       "/icon/slack.svg",
+	"swift":       "/icon/swift.svg",
+	"tensorflow":  "/icon/tensorflow.svg",
+	"terminal":    "/icon/terminal.svg",
+	"theia":       "/icon/theia.svg",
+	"ubuntu":      "/icon/ubuntu.svg",
+	"vault":       "/icon/vault.svg",
+	"webstorm":    "/icon/webstorm.svg",
+	"widgets":     "/icon/widgets.svg",
+	"windows":     "/icon/windows.svg",
+}
+
+func iconsDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to reference the icons bundled with the Coder dashboard by name. Referencing an icon that does not exist fails at plan time instead of rendering a broken image.",
+		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			// The icons are bundled with the provider, so the ID only changes
+			// with them.
+			rd.SetId(deterministicID("icons"))
+			err := rd.Set("icons", BuiltinIcons)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"icons": {
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+				Description: "A map of icon names (e.g. \"go\" or \"jupyter\") to their paths on the Coder deployment (e.g. \"/icon/go.svg\").",
+			},
+		},
+	}
+}
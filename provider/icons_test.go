@@ -0,0 +1,101 @@
+package provider_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/terraform-provider-coder/provider"
+)
+
+func TestIcons(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_icons" "builtin" {
+			}
+			resource "coder_app" "jupyter" {
+				agent_id = "some id"
+				slug = "jupyter"
+				icon = data.coder_icons.builtin.icons["jupyter"]
+				url = "http://localhost:8888"
+			}`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 2)
+				icons := state.Modules[0].Resources["data.coder_icons.builtin"]
+				require.NotNil(t, icons)
+				require.Equal(t, "/icon/go.svg", icons.Primary.Attributes["icons.go"])
+				app := state.Modules[0].Resources["coder_app.jupyter"]
+				require.NotNil(t, app)
+				require.Equal(t, "/icon/jupyter.svg", app.Primary.Attributes["icon"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestIconsStableID(t *testing.T) {
+	t.Parallel()
+	var id string
+	step := resource.TestStep{
+		Config: `
+			provider "coder" {
+			}
+			data "coder_icons" "builtin" {
+			}`,
+		Check: func(state *terraform.State) error {
+			resource := state.Modules[0].Resources["data.coder_icons.builtin"]
+			require.NotNil(t, resource)
+			if id == "" {
+				id = resource.Primary.ID
+			}
+			require.Equal(t, id, resource.Primary.ID)
+			return nil
+		},
+	}
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps:      []resource.TestStep{step, step},
+	})
+}
+
+func TestIconsUnknown(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_icons" "builtin" {
+			}
+			resource "coder_app" "missing" {
+				agent_id = "some id"
+				slug = "missing"
+				icon = data.coder_icons.builtin.icons["does-not-exist"]
+				url = "http://localhost:8888"
+			}`,
+			ExpectError: regexp.MustCompile(`The given key does not identify an element in this collection value`),
+		}},
+	})
+}
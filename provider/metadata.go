@@ -2,13 +2,31 @@ package provider
 
 import (
 	"context"
-	"net/url"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
 )
 
+// metadataKeyRegex matches the keys the dashboard is able to display.
+var metadataKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.\- ]+$`)
+
+// metadataKeyInvalidCharsRegex matches the characters flattened keys may not
+// contain.
+var metadataKeyInvalidCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_.\- ]`)
+
+// metadataKeyMaxLength is the maximum length of a metadata key.
+const metadataKeyMaxLength = 128
+
 func metadataResource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this resource to attach metadata to a resource. They will be " +
@@ -33,6 +51,38 @@ func metadataResource() *schema.Resource {
 		DeleteContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
 			return nil
 		},
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			config, valid := i.(config)
+			if !valid {
+				return xerrors.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			if err := planIcon(rd, config, "icon"); err != nil {
+				return err
+			}
+			hide, _ := rd.Get("hide").(bool)
+			hideReason, _ := rd.Get("hide_reason").(string)
+			if rd.NewValueKnown("hide") && !hide && hideReason != "" {
+				return xerrors.New(`hide_reason can only be set when "hide" is true`)
+			}
+			err := planMetadataItems(rd)
+			if err != nil {
+				return err
+			}
+			if !rd.NewValueKnown("item") {
+				return nil
+			}
+			items, _ := rd.Get("item").([]interface{})
+			keys := map[string]struct{}{}
+			for _, item := range items {
+				item, _ := item.(map[string]interface{})
+				key, _ := item["key"].(string)
+				if _, exists := keys[key]; exists {
+					return xerrors.Errorf("duplicate metadata key %q", key)
+				}
+				keys[key] = struct{}{}
+			}
+			return nil
+		},
 		Schema: map[string]*schema.Schema{
 			"resource_id": {
 				Type:        schema.TypeString,
@@ -46,20 +96,21 @@ func metadataResource() *schema.Resource {
 				ForceNew:    true,
 				Optional:    true,
 			},
+			"hide_reason": {
+				Type:        schema.TypeString,
+				Description: "Why the resource is hidden, shown to template admins to explain what's missing from the workspace page. Requires \"hide\" to be true.",
+				ForceNew:    true,
+				Optional:    true,
+			},
 			"icon": {
 				Type: schema.TypeString,
 				Description: "A URL to an icon that will display in the dashboard. View built-in " +
 					"icons here: https://github.com/coder/coder/tree/main/site/static/icon. Use a " +
 					"built-in icon with `data.coder_workspace.me.access_url + \"/icon/<path>\"`.",
-				ForceNew: true,
-				Optional: true,
-				ValidateFunc: func(i interface{}, s string) ([]string, []error) {
-					_, err := url.Parse(s)
-					if err != nil {
-						return nil, []error{err}
-					}
-					return nil, nil
-				},
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validateIcon,
+				StateFunc:    resolveIcon,
 			},
 			"daily_cost": {
 				Type: schema.TypeInt,
@@ -74,19 +125,27 @@ func metadataResource() *schema.Resource {
 				Description: "Each \"item\" block defines a single metadata item consisting of a key/value pair.",
 				ForceNew:    true,
 				Optional:    true,
+				// Computed so flattened items can be planned.
+				Computed: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"key": {
 							Type:        schema.TypeString,
-							Description: "The key of this metadata item.",
+							Description: "The key of this metadata item. Keys must be unique within the resource, at most 128 characters long, and may contain letters, digits, spaces, underscores, hyphens and periods.",
 							ForceNew:    true,
 							Required:    true,
+							ValidateFunc: validation.All(
+								validation.StringLenBetween(1, metadataKeyMaxLength),
+								validation.StringMatch(metadataKeyRegex, "may only contain letters, digits, spaces, underscores, hyphens and periods"),
+							),
 						},
 						"value": {
-							Type:        schema.TypeString,
-							Description: "The value of this metadata item.",
-							ForceNew:    true,
-							Optional:    true,
+							Type: schema.TypeString,
+							Description: "The value of this metadata item. Values are redacted from plan output and " +
+								"marked sensitive in state, since the SDK can't mark only the values of sensitive items.",
+							ForceNew:  true,
+							Optional:  true,
+							Sensitive: true,
 						},
 						"sensitive": {
 							Type: schema.TypeBool,
@@ -98,6 +157,28 @@ func metadataResource() *schema.Resource {
 							Optional: true,
 							Default:  false,
 						},
+						"hide": {
+							Type:        schema.TypeBool,
+							Description: "Hide this item from the UI while still showing the rest of the resource.",
+							ForceNew:    true,
+							Optional:    true,
+							Default:     false,
+						},
+						"flatten": {
+							Type: schema.TypeBool,
+							Description: "Set to \"true\" when \"value\" is a JSON object or array, such as the " +
+								"jsonencode() of a cloud resource's tags, to show each value in it as an item keyed " +
+								"by its path, like \"tags.team\". Characters keys may not contain are replaced with underscores.",
+							ForceNew: true,
+							Optional: true,
+							Default:  false,
+						},
+						"order": {
+							Type:        schema.TypeInt,
+							Description: "The order determines the position of the item in the UI presentation. The lowest order is shown first and items with equal order keep the order they're declared in.",
+							ForceNew:    true,
+							Optional:    true,
+						},
 						"is_null": {
 							Type:     schema.TypeBool,
 							ForceNew: true,
@@ -109,3 +190,101 @@ func metadataResource() *schema.Resource {
 		},
 	}
 }
+
+// planMetadataItems plans the configured items, with the values of items
+// that set "flatten" expanded into an item each.
+func planMetadataItems(rd *schema.ResourceDiff) error {
+	configured := rd.GetRawConfig().GetAttr("item")
+	if !configured.IsWhollyKnown() {
+		return nil
+	}
+	items := []interface{}{}
+	if !configured.IsNull() {
+		for _, item := range configured.AsValueSlice() {
+			sensitive, _ := valueAsBool(item.GetAttr("sensitive")).(bool)
+			hide, _ := valueAsBool(item.GetAttr("hide")).(bool)
+			flatten, _ := valueAsBool(item.GetAttr("flatten")).(bool)
+			planned := map[string]interface{}{
+				"key":       valueAsString(item.GetAttr("key")),
+				"value":     valueAsString(item.GetAttr("value")),
+				"sensitive": sensitive,
+				"hide":      hide,
+				"flatten":   flatten,
+				"order":     valueAsInt(item.GetAttr("order")),
+				"is_null":   item.GetAttr("value").IsNull(),
+			}
+			if !flatten {
+				items = append(items, planned)
+				continue
+			}
+			flattened, err := flattenMetadataItem(planned)
+			if err != nil {
+				return err
+			}
+			items = append(items, flattened...)
+		}
+	}
+	return rd.SetNew("item", items)
+}
+
+// flattenMetadataItem expands an item with a JSON object or array value into
+// an item for each value in it. Other fields are copied to every item.
+func flattenMetadataItem(item map[string]interface{}) ([]interface{}, error) {
+	key, _ := item["key"].(string)
+	value, _ := item["value"].(string)
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var decoded interface{}
+	err := decoder.Decode(&decoded)
+	if err != nil {
+		return nil, xerrors.Errorf("metadata item %q sets flatten, but its value isn't JSON: %w", key, err)
+	}
+	switch decoded.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return nil, xerrors.Errorf("metadata item %q sets flatten, but its value isn't a JSON object or array", key)
+	}
+	items := []interface{}{}
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(value))
+			for name := range value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				walk(path+"."+metadataKeyInvalidCharsRegex.ReplaceAllString(name, "_"), value[name])
+			}
+		case []interface{}:
+			for i, element := range value {
+				walk(path+"."+strconv.Itoa(i), element)
+			}
+		default:
+			flattened := make(map[string]interface{}, len(item))
+			for field, fieldValue := range item {
+				flattened[field] = fieldValue
+			}
+			flattened["key"] = path
+			switch value := value.(type) {
+			case nil:
+				flattened["value"] = ""
+				flattened["is_null"] = true
+			case string:
+				flattened["value"] = value
+			default:
+				flattened["value"] = fmt.Sprint(value)
+			}
+			items = append(items, flattened)
+		}
+	}
+	walk(key, decoded)
+	for _, flattened := range items {
+		flattenedKey, _ := flattened.(map[string]interface{})["key"].(string)
+		if len(flattenedKey) > metadataKeyMaxLength {
+			return nil, xerrors.Errorf("metadata item %q flattens to the key %q, which is longer than %d characters", key, flattenedKey, metadataKeyMaxLength)
+		}
+	}
+	return items, nil
+}
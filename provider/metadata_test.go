@@ -1,7 +1,9 @@
 package provider_test
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/coder/terraform-provider-coder/provider"
@@ -30,16 +32,19 @@ func TestMetadata(t *testing.T) {
 				resource "coder_metadata" "agent" {
 					resource_id = coder_agent.dev.id
 					hide = true
+					hide_reason = "Managed by the platform team"
 					icon = "/icon/storage.svg"
 					daily_cost = 200
 					item {
 						key = "foo"
 						value = "bar"
+						order = 2
 					}
 					item {
 						key = "secret"
 						value = "squirrel"
 						sensitive = true
+						hide = true
 					}
 					item {
 						key = "implicit_null"
@@ -65,15 +70,20 @@ func TestMetadata(t *testing.T) {
 				for key, expected := range map[string]string{
 					"resource_id":      agent.Primary.Attributes["id"],
 					"hide":             "true",
+					"hide_reason":      "Managed by the platform team",
 					"icon":             "/icon/storage.svg",
 					"daily_cost":       "200",
 					"item.#":           "5",
 					"item.0.key":       "foo",
 					"item.0.value":     "bar",
 					"item.0.sensitive": "false",
+					"item.0.hide":      "false",
+					"item.0.order":     "2",
 					"item.1.key":       "secret",
 					"item.1.value":     "squirrel",
 					"item.1.sensitive": "true",
+					"item.1.hide":      "true",
+					"item.1.order":     "0",
 					"item.2.key":       "implicit_null",
 					"item.2.is_null":   "true",
 					"item.2.sensitive": "false",
@@ -93,6 +103,15 @@ func TestMetadata(t *testing.T) {
 	})
 }
 
+func TestMetadataSensitive(t *testing.T) {
+	t.Parallel()
+
+	metadata := provider.New().ResourcesMap["coder_metadata"]
+	item, ok := metadata.Schema["item"].Elem.(*schema.Resource)
+	require.True(t, ok)
+	require.True(t, item.Schema["value"].Sensitive)
+}
+
 func TestMetadataDuplicateKeys(t *testing.T) {
 	t.Parallel()
 	prov := provider.New()
@@ -127,3 +146,155 @@ func TestMetadataDuplicateKeys(t *testing.T) {
 		}},
 	})
 }
+
+func TestMetadataHideReasonRequiresHide(t *testing.T) {
+	t.Parallel()
+	prov := provider.New()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": prov,
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_metadata" "agent" {
+					resource_id = coder_agent.dev.id
+					hide_reason = "Not interesting"
+				}
+				`,
+			ExpectError: regexp.MustCompile(`hide_reason can only be set when "hide" is true`),
+		}},
+	})
+}
+
+func TestMetadataInvalidKey(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		Name        string
+		Key         string
+		ExpectError *regexp.Regexp
+	}{{
+		Name:        "Empty",
+		Key:         "",
+		ExpectError: regexp.MustCompile(`expected length of item.0.key to be in the range \(1 - 128\)`),
+	}, {
+		Name:        "TooLong",
+		Key:         strings.Repeat("a", 129),
+		ExpectError: regexp.MustCompile(`expected length of item.0.key to be in the range \(1 - 128\)`),
+	}, {
+		Name:        "InvalidCharacters",
+		Key:         "disk/size",
+		ExpectError: regexp.MustCompile(`may only contain letters, digits, spaces, underscores, hyphens and periods`),
+	}} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			resource.Test(t, resource.TestCase{
+				Providers: map[string]*schema.Provider{
+					"coder": provider.New(),
+				},
+				IsUnitTest: true,
+				Steps: []resource.TestStep{{
+					Config: fmt.Sprintf(`
+						provider "coder" {
+						}
+						resource "coder_metadata" "agent" {
+							resource_id = "some id"
+							item {
+								key = %q
+								value = "bar"
+							}
+						}
+						`, tc.Key),
+					ExpectError: tc.ExpectError,
+				}},
+			})
+		})
+	}
+}
+
+func TestMetadataFlatten(t *testing.T) {
+	t.Parallel()
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_metadata" "agent" {
+					resource_id = coder_agent.dev.id
+					item {
+						key = "region"
+						value = "us-east-1"
+					}
+					item {
+						key = "tags"
+						value = jsonencode({
+							"team" = "platform"
+							"aws:owner" = "jdoe"
+							"gpu" = { "count" = 2, "spot" = true }
+							"retired" = null
+						})
+						flatten = true
+						order = 1
+					}
+				}
+				`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				metadata := state.Modules[0].Resources["coder_metadata.agent"]
+				require.NotNil(t, metadata)
+				for key, expected := range map[string]string{
+					"item.#":         "6",
+					"item.0.key":     "region",
+					"item.0.value":   "us-east-1",
+					"item.1.key":     "tags.aws_owner",
+					"item.1.value":   "jdoe",
+					"item.1.order":   "1",
+					"item.2.key":     "tags.gpu.count",
+					"item.2.value":   "2",
+					"item.3.key":     "tags.gpu.spot",
+					"item.3.value":   "true",
+					"item.4.key":     "tags.retired",
+					"item.4.is_null": "true",
+					"item.5.key":     "tags.team",
+					"item.5.value":   "platform",
+				} {
+					require.Equal(t, expected, metadata.Primary.Attributes[key], key)
+				}
+				return nil
+			},
+		}, {
+			Config: `
+				provider "coder" {
+				}
+				resource "coder_agent" "dev" {
+					os = "linux"
+					arch = "amd64"
+				}
+				resource "coder_metadata" "agent" {
+					resource_id = coder_agent.dev.id
+					item {
+						key = "tags"
+						value = "not json"
+						flatten = true
+					}
+				}
+				`,
+			ExpectError: regexp.MustCompile(`metadata item "tags" sets flatten, but its value isn't JSON`),
+		}},
+	})
+}
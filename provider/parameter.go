@@ -6,11 +6,15 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-cty/cty"
@@ -22,10 +26,27 @@ import (
 )
 
 type Option struct {
-	Name        string
-	Description string
-	Value       string
-	Icon        string
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Value       string               `json:"value"`
+	Icon        string               `json:"icon,omitempty"`
+	Cost        int                  `json:"cost,omitempty"`
+	Condition   []ParameterCondition `json:"condition,omitempty"`
+}
+
+// ParameterCondition holds when the parameter named Parameter has one of
+// Values.
+type ParameterCondition struct {
+	Parameter string   `json:"parameter"`
+	Values    []string `json:"values"`
+}
+
+// DefaultRule replaces the default of a parameter with Default when the
+// parameter named Parameter has one of Values.
+type DefaultRule struct {
+	Parameter string   `json:"parameter"`
+	Values    []string `json:"values"`
+	Default   string   `json:"default"`
 }
 
 type Validation struct {
@@ -36,8 +57,14 @@ type Validation struct {
 
 	Monotonic string
 
-	Regex string
-	Error string
+	Regex    string
+	KeyRegex string `mapstructure:"key_regex"`
+	Error    string
+
+	MinTimestamp string `mapstructure:"min_timestamp"`
+	MaxTimestamp string `mapstructure:"max_timestamp"`
+	MinFromNow   string `mapstructure:"min_from_now"`
+	MaxFromNow   string `mapstructure:"max_from_now"`
 }
 
 const (
@@ -59,15 +86,46 @@ type Parameter struct {
 	Optional    bool
 	Order       int
 	Ephemeral   bool
+	FormType    string `mapstructure:"form_type"`
+	Language    string
+
+	Computed          bool
+	Unit              string
+	DisplayMultiplier float64 `mapstructure:"display_multiplier"`
+	TrueLabel         string  `mapstructure:"true_label"`
+	FalseLabel        string  `mapstructure:"false_label"`
+	Condition         []ParameterCondition
+	DefaultRule       []DefaultRule `mapstructure:"default_rule"`
+}
+
+// ParameterFormTypes lists the form types that can be used to render a
+// parameter, along with the parameter types each of them supports.
+var ParameterFormTypes = map[string][]string{
+	"input":        {"string", "number"},
+	"textarea":     {"string"},
+	"radio":        {"string", "number", "bool"},
+	"dropdown":     {"string", "number"},
+	"checkbox":     {"bool"},
+	"switch":       {"bool"},
+	"tag-select":   {"list(string)"},
+	"multi-select": {"list(string)"},
+	"datetime":     {"timestamp"},
 }
 
 func parameterDataSource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this data source to configure editable options for workspaces.",
 		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
 			rd.SetId(uuid.NewString())
 
-			fixedValidation, err := fixValidationResourceData(rd.GetRawConfig(), rd.Get("validation"))
+			// The raw config is rebuilt on every call, so only fetch it once.
+			rawConfig := rd.GetRawConfig()
+			fixedValidation, err := fixValidationResourceData(rawConfig, rd.Get("validation"))
 			if err != nil {
 				return diag.FromErr(err)
 			}
@@ -77,6 +135,15 @@ func parameterDataSource() *schema.Resource {
 				return diag.FromErr(err)
 			}
 
+			hasDefault := !rawConfig.GetAttr("default").IsNull()
+			if name, _ := rd.Get("variable").(string); name != "" {
+				variable, diags := promoteVariable(rd, rawConfig, config, name)
+				if diags.HasError() {
+					return diags
+				}
+				hasDefault = hasDefault || variable.HasDefault
+			}
+
 			var parameter Parameter
 			err = mapstructure.Decode(struct {
 				Value       interface{}
@@ -92,6 +159,16 @@ func parameterDataSource() *schema.Resource {
 				Optional    interface{}
 				Order       interface{}
 				Ephemeral   interface{}
+				FormType    interface{} `mapstructure:"form_type"`
+				Language    interface{}
+
+				Computed          interface{}
+				Unit              interface{}
+				DisplayMultiplier interface{} `mapstructure:"display_multiplier"`
+				TrueLabel         interface{} `mapstructure:"true_label"`
+				FalseLabel        interface{} `mapstructure:"false_label"`
+				Condition         interface{}
+				DefaultRule       interface{} `mapstructure:"default_rule"`
 			}{
 				Value:       rd.Get("value"),
 				Name:        rd.Get("name"),
@@ -107,30 +184,95 @@ func parameterDataSource() *schema.Resource {
 					// This hack allows for checking if the "default" field is present in the .tf file.
 					// If "default" is missing or is "null", then it means that this field is required,
 					// and user must provide a value for it.
-					val := !rd.GetRawConfig().AsValueMap()["default"].IsNull()
+					val := hasDefault
 					rd.Set("optional", val)
 					return val
 				}(),
 				Order:     rd.Get("order"),
 				Ephemeral: rd.Get("ephemeral"),
+				FormType:  rd.Get("form_type"),
+				Language:  rd.Get("language"),
+
+				Computed:          rd.Get("computed"),
+				Unit:              rd.Get("unit"),
+				DisplayMultiplier: rd.Get("display_multiplier"),
+				TrueLabel:         rd.Get("true_label"),
+				FalseLabel:        rd.Get("false_label"),
+				Condition:         rd.Get("condition"),
+				DefaultRule:       rd.Get("default_rule"),
 			}, &parameter)
 			if err != nil {
 				return diag.Errorf("decode parameter: %s", err)
 			}
+			if err := validateIconHost(config, "icon", parameter.Icon); err != nil {
+				return withPath(diag.FromErr(err), cty.GetAttrPath("icon"))
+			}
+			for i, option := range parameter.Option {
+				if err := validateIconHost(config, "icon", option.Icon); err != nil {
+					return withPath(diag.FromErr(err), cty.GetAttrPath("option").IndexInt(i).GetAttr("icon"))
+				}
+			}
 			var value string
 			if parameter.Default != "" {
 				err := valueIsType(parameter.Type, parameter.Default)
 				if err != nil {
-					return err
+					return withPath(err, cty.GetAttrPath("default"))
 				}
 				value = parameter.Default
 			}
-			envValue, ok := os.LookupEnv(ParameterEnvironmentVariable(parameter.Name))
-			if ok {
+
+			// Conditions refer to the values of other parameters, either
+			// read before this one or set by the provisioner.
+			lookup := func(name string) (string, bool) {
+				return parameterValue(config, name)
+			}
+			if diags := parameter.validConditions(hasDefault); diags.HasError() {
+				return diags
+			}
+			for _, rule := range parameter.DefaultRule {
+				if rule.holds(lookup) {
+					value = rule.Default
+					break
+				}
+			}
+			visible := holdAll(parameter.Condition, lookup)
+			rd.Set("visible", visible)
+
+			// Hidden parameters keep their default, so values submitted
+			// before they were hidden don't linger.
+			envValue, ok := config.Env.Lookup(ParameterEnvironmentVariable(parameter.Name))
+			ok = ok && visible
+			if ok && !parameter.Computed {
 				value = envValue
 			}
 			rd.Set("value", value)
 
+			if parameter.Computed {
+				// Computed parameters aren't shown in the form, so their value
+				// always comes from evaluating "default".
+				path := cty.GetAttrPath("computed")
+				if !parameter.Optional {
+					return withPath(diag.Errorf("computed parameters require a default"), path)
+				}
+				if parameter.Ephemeral {
+					return withPath(diag.Errorf("computed parameters can't be ephemeral"), path)
+				}
+				if parameter.FormType != "" {
+					return withPath(diag.Errorf("computed parameters aren't shown in the form, so form_type can't be set"), path)
+				}
+			}
+
+			if after, _ := rd.Get("order_after").(string); after != "" {
+				previous, found := config.ParameterOrders.Load(after)
+				if !found {
+					return withPath(diag.Errorf("order_after references parameter %q, which hasn't been read; reference it as data.coder_parameter.<name>.name", after), cty.GetAttrPath("order_after"))
+				}
+				parameter.Order, _ = previous.(int)
+				parameter.Order++
+				rd.Set("order", parameter.Order)
+			}
+			config.ParameterOrders.Store(parameter.Name, parameter.Order)
+
 			if !parameter.Mutable && parameter.Ephemeral {
 				return diag.Errorf("parameter can't be immutable and ephemeral")
 			}
@@ -139,41 +281,134 @@ func parameterDataSource() *schema.Resource {
 				return diag.Errorf("ephemeral parameter requires the default property")
 			}
 
+			// Options loaded from a file are validated like "option" blocks,
+			// but diagnostics point at "options_file" instead.
+			optionPath := func(i int, attr string) cty.Path {
+				return cty.GetAttrPath("option").IndexInt(i).GetAttr(attr)
+			}
+			optionsFile, _ := rd.Get("options_file").(string)
+			optionsJSON := ""
+			if optionsFile != "" {
+				parameter.Option, err = readOptionsFile(optionsFile)
+				if err != nil {
+					return withPath(diag.FromErr(err), cty.GetAttrPath("options_file"))
+				}
+				data, err := json.Marshal(parameter.Option)
+				if err != nil {
+					return diag.Errorf("encode options: %s", err)
+				}
+				optionsJSON = string(data)
+				optionPath = func(int, string) cty.Path {
+					return cty.GetAttrPath("options_file")
+				}
+			}
+			rd.Set("options_json", optionsJSON)
+
+			err = validFormType(parameter.FormType, parameter.Type, len(parameter.Option) > 0)
+			if err != nil {
+				return withPath(diag.FromErr(err), cty.GetAttrPath("form_type"))
+			}
+			if parameter.Language != "" && parameter.FormType != "textarea" {
+				return withPath(diag.Errorf("language can only be set when form_type is \"textarea\""), cty.GetAttrPath("language"))
+			}
+			if parameter.Type != "bool" {
+				for _, label := range [][2]string{{"true_label", parameter.TrueLabel}, {"false_label", parameter.FalseLabel}} {
+					if label[1] != "" {
+						return withPath(diag.Errorf("%s can only be set on \"bool\" parameters", label[0]), cty.GetAttrPath(label[0]))
+					}
+				}
+			}
+			if parameter.Type != "number" {
+				if parameter.Unit != "" {
+					return withPath(diag.Errorf("unit can only be set on \"number\" parameters"), cty.GetAttrPath("unit"))
+				}
+				if parameter.DisplayMultiplier != 1 {
+					return withPath(diag.Errorf("display_multiplier can only be set on \"number\" parameters"), cty.GetAttrPath("display_multiplier"))
+				}
+			}
+
 			if len(parameter.Validation) == 1 {
 				validation := &parameter.Validation[0]
-				err = validation.Valid(parameter.Type, value)
+				err = validation.validRange()
 				if err != nil {
-					return diag.FromErr(err)
+					return withPath(diag.FromErr(err), cty.GetAttrPath("validation").IndexInt(0).GetAttr("min"))
+				}
+				if parameter.Default != "" {
+					// Check the default separately so the diagnostic points
+					// at the attribute that needs to change.
+					err = validation.Valid(parameter.Type, parameter.Default)
+					if err != nil {
+						diags := withPath(diag.FromErr(err), cty.GetAttrPath("default"))
+						if parameter.Type == "number" {
+							diags[0].Detail = fmt.Sprintf("The default value %s must be %s.", parameter.Default, validation.rangeDescription())
+						}
+						return diags
+					}
+				}
+				// The default was already validated above.
+				if parameter.Default == "" || value != parameter.Default {
+					err = validation.Valid(parameter.Type, value)
+					if err != nil {
+						return diag.FromErr(err)
+					}
 				}
 			}
 
 			if len(parameter.Option) > 0 {
+				var diags diag.Diagnostics
 				names := map[string]interface{}{}
 				values := map[string]interface{}{}
-				for _, option := range parameter.Option {
+				for i, option := range parameter.Option {
 					_, exists := names[option.Name]
 					if exists {
-						return diag.Errorf("multiple options cannot have the same name %q", option.Name)
+						diags = append(diags, withPath(diag.Errorf("multiple options cannot have the same name %q", option.Name), optionPath(i, "name"))...)
 					}
 					_, exists = values[option.Value]
 					if exists {
-						return diag.Errorf("multiple options cannot have the same value %q", option.Value)
+						diags = append(diags, withPath(diag.Errorf("multiple options cannot have the same value %q", option.Value), optionPath(i, "value"))...)
 					}
-					err := valueIsType(parameter.Type, option.Value)
-					if err != nil {
-						return err
+					// The options of a "list(string)" parameter are the items
+					// that can be selected, rather than whole lists.
+					if parameter.Type != "list(string)" {
+						err := valueIsType(parameter.Type, option.Value)
+						if err != nil {
+							diags = append(diags, withPath(err, optionPath(i, "value"))...)
+						}
 					}
 					values[option.Value] = nil
 					names[option.Name] = nil
 				}
 
 				if parameter.Default != "" {
-					_, defaultIsValid := values[parameter.Default]
-					if !defaultIsValid {
-						return diag.Errorf("default value %q must be defined as one of options", parameter.Default)
+					err := parameter.validOptionValue(parameter.Default)
+					if err != nil {
+						diags = append(diags, withPath(diag.Errorf("default value %s", err), cty.GetAttrPath("default"))...)
+					}
+				}
+				if parameter.Type == "list(string)" && value != "" && value != parameter.Default {
+					err := parameter.validOptionValue(value)
+					if err != nil {
+						diags = append(diags, diag.Errorf("value %s", err)...)
 					}
 				}
+				if diags.HasError() {
+					return diags
+				}
+			}
+			if ok && !parameter.Computed && len(parameter.Option) > 0 {
+				if unavailable, found := parameter.unavailableOption(value, lookup); found {
+					return diag.Errorf("option %q of parameter %q isn't available with the values of the parameters it depends on", unavailable, parameter.Name)
+				}
+			}
+
+			form, err := parameter.form(visible)
+			if err != nil {
+				return diag.Errorf("encode form: %s", err)
 			}
+			rd.Set("form", form)
+			config.ParameterValues.Store(parameter.Name, value)
+			rd.Set("display_value", parameter.displayValue(value))
+			rd.Set("cost", parameter.cost(value))
 			return nil
 		},
 		Schema: map[string]*schema.Schema{
@@ -182,6 +417,18 @@ func parameterDataSource() *schema.Resource {
 				Computed:    true,
 				Description: "The output value of the parameter.",
 			},
+			"cost": {
+				Type:     schema.TypeInt,
+				Computed: true,
+				Description: "The quota credits per day consumed by the selected option, or the sum of the selected " +
+					"options of a \"list(string)\" parameter. Use it in the \"daily_cost\" of a \"coder_metadata\" " +
+					"resource to charge for the choice.",
+			},
+			"display_value": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The value as shown in the form: divided by \"display_multiplier\" and followed by \"unit\".",
+			},
 			"name": {
 				Type:        schema.TypeString,
 				Required:    true,
@@ -201,8 +448,8 @@ func parameterDataSource() *schema.Resource {
 				Type:         schema.TypeString,
 				Default:      "string",
 				Optional:     true,
-				ValidateFunc: validation.StringInSlice([]string{"number", "string", "bool", "list(string)"}, false),
-				Description:  `The type of this parameter. Must be one of: "number", "string", "bool", or "list(string)".`,
+				ValidateFunc: validation.StringInSlice([]string{"number", "string", "bool", "list(string)", "map(string)", "timestamp"}, false),
+				Description:  `The type of this parameter. Must be one of: "number", "string", "bool", "list(string)", "map(string)", or "timestamp". The value of "timestamp" parameters is an RFC 3339 timestamp. The value of "list(string)" and "map(string)" parameters is JSON encoded; use jsondecode() to get a native list or map.`,
 			},
 			"mutable": {
 				Type:        schema.TypeBool,
@@ -220,15 +467,10 @@ func parameterDataSource() *schema.Resource {
 				Description: "A URL to an icon that will display in the dashboard. View built-in " +
 					"icons here: https://github.com/coder/coder/tree/main/site/static/icon. Use a " +
 					"built-in icon with `data.coder_workspace.me.access_url + \"/icon/<path>\"`.",
-				ForceNew: true,
-				Optional: true,
-				ValidateFunc: func(i interface{}, s string) ([]string, []error) {
-					_, err := url.Parse(s)
-					if err != nil {
-						return nil, []error{err}
-					}
-					return nil, nil
-				},
+				ForceNew:     true,
+				Optional:     true,
+				ValidateFunc: validateIcon,
+				StateFunc:    resolveIcon,
 			},
 			"option": {
 				Type:        schema.TypeList,
@@ -261,19 +503,83 @@ func parameterDataSource() *schema.Resource {
 							Description: "A URL to an icon that will display in the dashboard. View built-in " +
 								"icons here: https://github.com/coder/coder/tree/main/site/static/icon. Use a " +
 								"built-in icon with `data.coder_workspace.me.access_url + \"/icon/<path>\"`.",
-							ForceNew: true,
-							Optional: true,
-							ValidateFunc: func(i interface{}, s string) ([]string, []error) {
-								_, err := url.Parse(s)
-								if err != nil {
-									return nil, []error{err}
-								}
-								return nil, nil
-							},
+							ForceNew:     true,
+							Optional:     true,
+							ValidateFunc: validateIcon,
+							StateFunc:    resolveIcon,
+						},
+						"cost": {
+							Type:         schema.TypeInt,
+							Description:  "The quota credits per day a workspace consumes when this option is selected, shown in the form before the workspace is created.",
+							ForceNew:     true,
+							Optional:     true,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"condition": parameterConditionSchema("Only offer this option when the condition holds. With multiple \"condition\" blocks, all of them must hold."),
+					},
+				},
+			},
+			"condition": parameterConditionSchema("Only show the parameter in the form when the condition holds, for example " +
+				"to ask for a GPU type only when GPUs are enabled. With multiple \"condition\" blocks, all of them must hold. " +
+				"Hidden parameters keep their default value."),
+			"default_rule": {
+				Type: schema.TypeList,
+				Description: "Replace \"default\" when another parameter has one of the given values, for example to default " +
+					"to more memory for larger instance types. The first rule that holds wins, and \"default\" is used when none do.",
+				ForceNew: true,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"parameter": {
+							Type:        schema.TypeString,
+							Description: "The name of the parameter the rule depends on. Reference it as `data.coder_parameter.<name>.name`, so it's read first.",
+							ForceNew:    true,
+							Required:    true,
+						},
+						"values": {
+							Type:        schema.TypeList,
+							Description: "The values of the parameter the rule applies for.",
+							ForceNew:    true,
+							Required:    true,
+							MinItems:    1,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"default": {
+							Type:        schema.TypeString,
+							Description: "The default value when the rule holds.",
+							ForceNew:    true,
+							Required:    true,
 						},
 					},
 				},
 			},
+			"visible": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether every \"condition\" holds, so the parameter is shown in the form.",
+			},
+			"form": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The definition of the parameter in the form, encoded as JSON, including its conditions, default " +
+					"rules and the conditions of its options. Coder evaluates it as users fill in the form, so it can show " +
+					"parameters, filter options and update defaults without a new build.",
+			},
+			"options_file": {
+				Type: schema.TypeString,
+				Description: "The path to a JSON file containing an array of options, each an object with \"name\", " +
+					"\"value\" and optional \"description\", \"icon\" and \"cost\" keys. Use this instead of \"option\" blocks for " +
+					"large option sets, such as every instance type of a cloud, which would otherwise bloat the plan. " +
+					"The file is read from the provisioner, and isn't limited to the 64 \"option\" blocks.",
+				ForceNew:      true,
+				Optional:      true,
+				ConflictsWith: []string{"option"},
+			},
+			"options_json": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The options read from \"options_file\", encoded as a single JSON array so Coder can page through and search them without expanding every option into the state.",
+			},
 			"validation": {
 				Type:        schema.TypeList,
 				MaxItems:    1,
@@ -301,6 +607,30 @@ func parameterDataSource() *schema.Resource {
 							Computed:    true,
 							Description: "Helper field to check if max is present",
 						},
+						"min_timestamp": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.IsRFC3339Time,
+							Description:  `The earliest value of a "timestamp" parameter, as an RFC 3339 timestamp.`,
+						},
+						"max_timestamp": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.IsRFC3339Time,
+							Description:  `The latest value of a "timestamp" parameter, as an RFC 3339 timestamp.`,
+						},
+						"min_from_now": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDuration,
+							Description:  `The earliest value of a "timestamp" parameter relative to the time of the build, as a duration such as "1h" or "-24h".`,
+						},
+						"max_from_now": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDuration,
+							Description:  `The latest value of a "timestamp" parameter relative to the time of the build, as a duration such as "720h" for 30 days.`,
+						},
 						"monotonic": {
 							Type:        schema.TypeString,
 							Optional:    true,
@@ -312,6 +642,12 @@ func parameterDataSource() *schema.Resource {
 							Description:   "A regex for the input parameter to match against.",
 							Optional:      true,
 						},
+						"key_regex": {
+							Type:          schema.TypeString,
+							ConflictsWith: []string{"validation.0.min", "validation.0.max", "validation.0.monotonic"},
+							Description:   `A regex each key of a "map(string)" parameter must match. "regex" is matched against each value.`,
+							Optional:      true,
+						},
 						"error": {
 							Type:        schema.TypeString,
 							Optional:    true,
@@ -326,9 +662,19 @@ func parameterDataSource() *schema.Resource {
 				Description: "Whether this value is optional.",
 			},
 			"order": {
-				Type:        schema.TypeInt,
-				Optional:    true,
-				Description: "The order determines the position of a template parameter in the UI/CLI presentation. The lowest order is shown first and parameters with equal order are sorted by name (ascending order).",
+				Type:          schema.TypeInt,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"order_after"},
+				Description:   "The order determines the position of a template parameter in the UI/CLI presentation. The lowest order is shown first and parameters with equal order are sorted by name (ascending order).",
+			},
+			"order_after": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"order"},
+				Description: "The name of a parameter to show this one after, e.g. `data.coder_parameter.region.name`. " +
+					"\"order\" is set to one more than the order of that parameter, so parameters can be chained " +
+					"without numbering them by hand. The parameter must be referenced so Terraform reads it first.",
 			},
 			"ephemeral": {
 				Type:        schema.TypeBool,
@@ -336,6 +682,70 @@ func parameterDataSource() *schema.Resource {
 				Optional:    true,
 				Description: "The value of an ephemeral parameter will not be preserved between consecutive workspace builds.",
 			},
+			"variable": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: "The name of a Terraform input variable declared by the template to promote to this " +
+					"parameter. Its type, description and default are used unless set on the parameter, so they " +
+					"don't have to be declared twice. Use the \"value\" of the parameter in place of the variable. " +
+					"Only variables declared in the \".tf\" and \".tf.json\" files of the template's root module " +
+					"can be promoted.",
+			},
+			"computed": {
+				Type:     schema.TypeBool,
+				Default:  false,
+				Optional: true,
+				Description: "Derive the value from other parameters instead of asking the user. The value is always " +
+					"\"default\", which can be an expression over other parameters, e.g. " +
+					"`data.coder_parameter.cpu.value * 4`. Computed parameters are hidden from the form, but are " +
+					"recorded with every build like other parameters.",
+			},
+			"form_type": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{"input", "textarea", "radio", "dropdown", "checkbox", "switch", "tag-select", "multi-select", "datetime"}, false),
+				Description:  `The widget used to render the parameter in the form. Must be one of: "input", "textarea", "radio", "dropdown", "checkbox", "switch", "tag-select", "multi-select", or "datetime". Defaults to a widget based on "type" and whether options are defined. "radio", "dropdown" and "multi-select" require options, "checkbox" and "switch" require a "bool" type, and "tag-select" and "multi-select" require a "list(string)" type, and "datetime" requires a "timestamp" type.`,
+			},
+			"true_label": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsNotWhiteSpace,
+				Description: `The label shown for the true state of a "bool" parameter, such as "Wipe home volume". ` +
+					`Use with a "form_type" of "switch", "checkbox" or "radio" to make destructive toggles clear.`,
+			},
+			"false_label": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsNotWhiteSpace,
+				Description:  `The label shown for the false state of a "bool" parameter, such as "Keep home volume".`,
+			},
+			"unit": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsNotWhiteSpace,
+				Description:  `The unit shown next to the value of a "number" parameter in the form, such as "GB", "GiB", "cores" or "ms".`,
+			},
+			"display_multiplier": {
+				Type:     schema.TypeFloat,
+				Optional: true,
+				Default:  1,
+				ValidateFunc: func(i interface{}, key string) ([]string, []error) {
+					if value, _ := i.(float64); value <= 0 {
+						return nil, []error{xerrors.Errorf("expected %q to be greater than 0, got %v", key, i)}
+					}
+					return nil, nil
+				},
+				Description: "The factor between the value shown in the form and the value the template receives, for " +
+					"\"number\" parameters. For example, with a multiplier of 1073741824 and a unit of \"GiB\", users " +
+					"enter 8 and \"value\" is 8589934592. \"default\", \"option\" values and \"validation\" use the " +
+					"value the template receives.",
+			},
+			"language": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{"yaml", "json", "bash"}, false),
+				Description:  `The syntax highlighting used by the editor of a "textarea" parameter. Must be one of: "yaml", "json", or "bash". Requires form_type to be "textarea".`,
+			},
 		},
 	}
 }
@@ -374,6 +784,66 @@ func fixValidationResourceData(rawConfig cty.Value, validation interface{}) (int
 	return vArr, nil
 }
 
+// withPath attaches path to each of the diagnostics so Terraform can point at
+// the offending attribute in the configuration.
+func withPath(diags diag.Diagnostics, path cty.Path) diag.Diagnostics {
+	for i := range diags {
+		diags[i].AttributePath = path
+	}
+	return diags
+}
+
+// readOptionsFile reads the options of a parameter from a JSON file.
+func readOptionsFile(path string) ([]Option, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read options file: %w", err)
+	}
+	var options []Option
+	err = json.Unmarshal(data, &options)
+	if err != nil {
+		return nil, xerrors.Errorf("decode options file %q: %w", path, err)
+	}
+	for i, option := range options {
+		if option.Name == "" || option.Value == "" {
+			return nil, xerrors.Errorf("option %d in %q must have a name and a value", i, path)
+		}
+		if option.Icon != "" {
+			_, errs := validateIcon(option.Icon, "icon")
+			if len(errs) > 0 {
+				return nil, xerrors.Errorf("option %d in %q has an invalid icon: %w", i, path, errs[0])
+			}
+		}
+	}
+	return options, nil
+}
+
+// validFormType ensures the form type is able to render a parameter of the
+// given type. An empty form type lets Coder pick one.
+func validFormType(formType, typ string, hasOptions bool) error {
+	if formType == "" {
+		return nil
+	}
+	types, ok := ParameterFormTypes[formType]
+	if !ok {
+		return xerrors.Errorf("invalid form_type %q", formType)
+	}
+	if !slices.Contains(types, typ) {
+		return xerrors.Errorf("form_type %q cannot be used with a %s parameter, it supports: %s", formType, typ, strings.Join(types, ", "))
+	}
+	switch formType {
+	case "radio", "dropdown", "multi-select":
+		if !hasOptions {
+			return xerrors.Errorf("form_type %q requires at least one option", formType)
+		}
+	case "input", "textarea", "checkbox", "switch":
+		if hasOptions {
+			return xerrors.Errorf("form_type %q cannot be used with options, use \"radio\" or \"dropdown\" instead", formType)
+		}
+	}
+	return nil
+}
+
 func valueIsType(typ, value string) diag.Diagnostics {
 	switch typ {
 	case "number":
@@ -392,6 +862,17 @@ func valueIsType(typ, value string) diag.Diagnostics {
 		if err != nil {
 			return diag.Errorf("%q is not an array of strings", value)
 		}
+	case "map(string)":
+		var items map[string]string
+		err := json.Unmarshal([]byte(value), &items)
+		if err != nil {
+			return diag.Errorf("%q is not an object of strings", value)
+		}
+	case "timestamp":
+		_, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return diag.Errorf("%q is not an RFC 3339 timestamp", value)
+		}
 	case "string":
 		// Anything is a string!
 	default:
@@ -412,9 +893,21 @@ func (v *Validation) Valid(typ, value string) error {
 			return fmt.Errorf("monotonic validation can only be specified for number types, not %s types", typ)
 		}
 	}
-	if typ != "string" && v.Regex != "" {
+	if typ != "string" && typ != "map(string)" && v.Regex != "" {
 		return fmt.Errorf("a regex cannot be specified for a %s type", typ)
 	}
+	if typ != "map(string)" && v.KeyRegex != "" {
+		return fmt.Errorf("a key_regex cannot be specified for a %s type", typ)
+	}
+	if typ != "timestamp" && (v.MinTimestamp != "" || v.MaxTimestamp != "" || v.MinFromNow != "" || v.MaxFromNow != "") {
+		return fmt.Errorf("timestamp bounds cannot be specified for a %s type", typ)
+	}
+	if typ == "number" {
+		err := v.validRange()
+		if err != nil {
+			return err
+		}
+	}
 	switch typ {
 	case "bool":
 		if value != "true" && value != "false" {
@@ -425,9 +918,9 @@ func (v *Validation) Valid(typ, value string) error {
 		if v.Regex == "" {
 			return nil
 		}
-		regex, err := regexp.Compile(v.Regex)
+		regex, err := compileValidationRegex(v.Regex)
 		if err != nil {
-			return fmt.Errorf("compile regex %q: %s", regex, err)
+			return fmt.Errorf("compile regex %q: %s", v.Regex, err)
 		}
 		if v.Error == "" {
 			return fmt.Errorf("an error must be specified with a regex validation")
@@ -456,10 +949,179 @@ func (v *Validation) Valid(typ, value string) error {
 		if err != nil {
 			return fmt.Errorf("value %q is not valid list of strings", value)
 		}
+	case "map(string)":
+		var mapOfStrings map[string]string
+		err := json.Unmarshal([]byte(value), &mapOfStrings)
+		if err != nil {
+			return fmt.Errorf("value %q is not valid map of strings", value)
+		}
+		return v.validMap(mapOfStrings)
+	case "timestamp":
+		timestamp, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("value %q is not an RFC 3339 timestamp", value)
+		}
+		return v.validTimestamp(timestamp, time.Now())
+	}
+	return nil
+}
+
+// validTimestamp ensures timestamp is within the absolute bounds, and within
+// the bounds relative to now.
+func (v *Validation) validTimestamp(timestamp, now time.Time) error {
+	var earliest, latest []time.Time
+	if v.MinTimestamp != "" {
+		limit, err := time.Parse(time.RFC3339, v.MinTimestamp)
+		if err != nil {
+			return fmt.Errorf("timestamp bound %q is not an RFC 3339 timestamp", v.MinTimestamp)
+		}
+		earliest = append(earliest, limit)
+	}
+	if v.MaxTimestamp != "" {
+		limit, err := time.Parse(time.RFC3339, v.MaxTimestamp)
+		if err != nil {
+			return fmt.Errorf("timestamp bound %q is not an RFC 3339 timestamp", v.MaxTimestamp)
+		}
+		latest = append(latest, limit)
+	}
+	if v.MinFromNow != "" {
+		offset, err := time.ParseDuration(v.MinFromNow)
+		if err != nil {
+			return fmt.Errorf("timestamp bound %q is not a duration", v.MinFromNow)
+		}
+		earliest = append(earliest, now.Add(offset))
+	}
+	if v.MaxFromNow != "" {
+		offset, err := time.ParseDuration(v.MaxFromNow)
+		if err != nil {
+			return fmt.Errorf("timestamp bound %q is not a duration", v.MaxFromNow)
+		}
+		latest = append(latest, now.Add(offset))
+	}
+
+	value := timestamp.Format(time.RFC3339)
+	for _, limit := range earliest {
+		if timestamp.Before(limit) {
+			return takeFirstError(v.errorRendered(value), fmt.Errorf("value %s is before %s", value, limit.Format(time.RFC3339)))
+		}
+	}
+	for _, limit := range latest {
+		if timestamp.After(limit) {
+			return takeFirstError(v.errorRendered(value), fmt.Errorf("value %s is after %s", value, limit.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// validateDuration ensures a value can be parsed by time.ParseDuration.
+func validateDuration(i interface{}, key string) ([]string, []error) {
+	value, ok := i.(string)
+	if !ok {
+		return nil, []error{xerrors.Errorf("expected %q to be a string, got %T", key, i)}
+	}
+	_, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, []error{xerrors.Errorf("expected %q to be a duration such as \"720h\": %w", key, err)}
+	}
+	return nil, nil
+}
+
+// validMap matches the keys of a "map(string)" value against key_regex, and
+// its values against regex.
+func (v *Validation) validMap(items map[string]string) error {
+	if v.Regex == "" && v.KeyRegex == "" {
+		return nil
+	}
+	if v.Error == "" {
+		return fmt.Errorf("an error must be specified with a regex validation")
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if v.KeyRegex != "" {
+		regex, err := compileValidationRegex(v.KeyRegex)
+		if err != nil {
+			return fmt.Errorf("compile key_regex %q: %s", v.KeyRegex, err)
+		}
+		for _, key := range keys {
+			if !regex.MatchString(key) {
+				return fmt.Errorf("%s (key %q does not match %q)", v.Error, key, regex)
+			}
+		}
+	}
+	if v.Regex != "" {
+		regex, err := compileValidationRegex(v.Regex)
+		if err != nil {
+			return fmt.Errorf("compile regex %q: %s", v.Regex, err)
+		}
+		for _, key := range keys {
+			if !regex.MatchString(items[key]) {
+				return fmt.Errorf("%s (value %q of key %q does not match %q)", v.Error, items[key], key, regex)
+			}
+		}
+	}
+	return nil
+}
+
+// validationRegexCacheSize bounds the number of compiled validation regexes
+// kept in memory, as the provider process may outlive a single template.
+const validationRegexCacheSize = 256
+
+// validationRegexes caches compiled validation regexes, since templates
+// with many parameters tend to share a handful of patterns. Once full it's
+// emptied rather than grown, so distinct patterns can't accumulate.
+var validationRegexes = struct {
+	mu      sync.Mutex
+	regexes map[string]*regexp.Regexp
+}{
+	regexes: map[string]*regexp.Regexp{},
+}
+
+func compileValidationRegex(pattern string) (*regexp.Regexp, error) {
+	validationRegexes.mu.Lock()
+	regex, ok := validationRegexes.regexes[pattern]
+	validationRegexes.mu.Unlock()
+	if ok {
+		return regex, nil
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	validationRegexes.mu.Lock()
+	defer validationRegexes.mu.Unlock()
+	if len(validationRegexes.regexes) >= validationRegexCacheSize {
+		validationRegexes.regexes = make(map[string]*regexp.Regexp, validationRegexCacheSize)
+	}
+	validationRegexes.regexes[pattern] = regex
+	return regex, nil
+}
+
+// validRange ensures the minimum is not greater than the maximum, as no value
+// could ever satisfy the validation.
+func (v *Validation) validRange() error {
+	if !v.MinDisabled && !v.MaxDisabled && v.Min > v.Max {
+		return xerrors.Errorf("the minimum %d cannot be greater than the maximum %d", v.Min, v.Max)
 	}
 	return nil
 }
 
+// rangeDescription describes the values accepted by a number validation,
+// e.g. "between 1 and 5".
+func (v *Validation) rangeDescription() string {
+	switch {
+	case !v.MinDisabled && !v.MaxDisabled:
+		return fmt.Sprintf("between %d and %d", v.Min, v.Max)
+	case !v.MinDisabled:
+		return fmt.Sprintf("at least %d", v.Min)
+	case !v.MaxDisabled:
+		return fmt.Sprintf("at most %d", v.Max)
+	}
+	return "a number"
+}
+
 // ParameterEnvironmentVariable returns the environment variable to specify for
 // a parameter by it's name. It's hashed because spaces and special characters
 // can be used in parameter names that may not be valid in env vars.
@@ -468,6 +1130,263 @@ func ParameterEnvironmentVariable(name string) string {
 	return "CODER_PARAMETER_" + hex.EncodeToString(sum[:])
 }
 
+// promoteVariable fills the attributes of a parameter that aren't set in its
+// configuration from the template variable name.
+func promoteVariable(rd *schema.ResourceData, rawConfig cty.Value, config config, name string) (terraformVariable, diag.Diagnostics) {
+	path := cty.GetAttrPath("variable")
+	variables, err := config.Variables()
+	if err != nil {
+		return terraformVariable{}, withPath(diag.Errorf("read template variables: %s", err), path)
+	}
+	variable, ok := variables[name]
+	if !ok {
+		return terraformVariable{}, withPath(diag.Errorf("variable %q is not declared by the template: only variables in the .tf and .tf.json files of its root module can be promoted", name), path)
+	}
+	if variable.Err != nil {
+		return terraformVariable{}, withPath(diag.FromErr(variable.Err), path)
+	}
+	if rawConfig.GetAttr("type").IsNull() {
+		rd.Set("type", variable.Type)
+	} else if typ, _ := rd.Get("type").(string); typ != variable.Type {
+		return terraformVariable{}, withPath(diag.Errorf("type %q doesn't match the type %q of variable %q", typ, variable.Type, name), cty.GetAttrPath("type"))
+	}
+	if rawConfig.GetAttr("description").IsNull() {
+		rd.Set("description", variable.Description)
+	}
+	if rawConfig.GetAttr("default").IsNull() && variable.HasDefault {
+		rd.Set("default", variable.Default)
+	}
+	return variable, nil
+}
+
+// validOptionValue ensures value is defined as one of the options. Each item
+// of a "list(string)" value must be an option instead.
+func (p *Parameter) validOptionValue(value string) error {
+	isOption := func(value string) bool {
+		return slices.ContainsFunc(p.Option, func(option Option) bool {
+			return option.Value == value
+		})
+	}
+	if p.Type != "list(string)" {
+		if !isOption(value) {
+			return xerrors.Errorf("%q must be defined as one of options", value)
+		}
+		return nil
+	}
+	var items []string
+	err := json.Unmarshal([]byte(value), &items)
+	if err != nil {
+		return xerrors.Errorf("%q is not an array of strings", value)
+	}
+	for _, item := range items {
+		if !isOption(item) {
+			return xerrors.Errorf("%q contains %q, which is not defined as one of options", value, item)
+		}
+	}
+	return nil
+}
+
+// parameterValue returns the value of the parameter named name, read before
+// or set by the provisioner.
+func parameterValue(config config, name string) (string, bool) {
+	if value, ok := config.ParameterValues.Load(name); ok {
+		return value.(string), true
+	}
+	return config.Env.Lookup(ParameterEnvironmentVariable(name))
+}
+
+// parameterConditionSchema returns the schema of "condition" blocks.
+func parameterConditionSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: description,
+		ForceNew:    true,
+		Optional:    true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"parameter": {
+					Type:        schema.TypeString,
+					Description: "The name of the parameter the condition depends on. Reference it as `data.coder_parameter.<name>.name`, so it's read first.",
+					ForceNew:    true,
+					Required:    true,
+				},
+				"values": {
+					Type:        schema.TypeList,
+					Description: "The values of the parameter the condition holds for.",
+					ForceNew:    true,
+					Required:    true,
+					MinItems:    1,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+			},
+		},
+	}
+}
+
+// holds returns whether the parameter the condition depends on has one of
+// its values. It doesn't hold if that parameter has no value.
+func (c ParameterCondition) holds(lookup func(name string) (string, bool)) bool {
+	value, ok := lookup(c.Parameter)
+	return ok && slices.Contains(c.Values, value)
+}
+
+func (r DefaultRule) holds(lookup func(name string) (string, bool)) bool {
+	return ParameterCondition{Parameter: r.Parameter, Values: r.Values}.holds(lookup)
+}
+
+// holdAll returns whether every condition holds.
+func holdAll(conditions []ParameterCondition, lookup func(name string) (string, bool)) bool {
+	for _, condition := range conditions {
+		if !condition.holds(lookup) {
+			return false
+		}
+	}
+	return true
+}
+
+// validConditions ensures conditions and default rules don't depend on the
+// parameter itself, and that rules have valid defaults.
+func (p *Parameter) validConditions(hasDefault bool) diag.Diagnostics {
+	for i, condition := range p.Condition {
+		if condition.Parameter == p.Name {
+			return withPath(diag.Errorf("a parameter can't depend on itself"), cty.GetAttrPath("condition").IndexInt(i).GetAttr("parameter"))
+		}
+	}
+	for i, option := range p.Option {
+		for j, condition := range option.Condition {
+			if condition.Parameter == p.Name {
+				return withPath(diag.Errorf("an option can't depend on its own parameter"), cty.GetAttrPath("option").IndexInt(i).GetAttr("condition").IndexInt(j).GetAttr("parameter"))
+			}
+		}
+	}
+	if len(p.DefaultRule) > 0 && !hasDefault {
+		return withPath(diag.Errorf("default_rule requires a default for when no rule holds"), cty.GetAttrPath("default_rule"))
+	}
+	for i, rule := range p.DefaultRule {
+		path := cty.GetAttrPath("default_rule").IndexInt(i)
+		if rule.Parameter == p.Name {
+			return withPath(diag.Errorf("a parameter can't depend on itself"), path.GetAttr("parameter"))
+		}
+		if diags := valueIsType(p.Type, rule.Default); diags.HasError() {
+			return withPath(diags, path.GetAttr("default"))
+		}
+		if len(p.Option) > 0 {
+			if err := p.validOptionValue(rule.Default); err != nil {
+				return withPath(diag.Errorf("default value %s", err), path.GetAttr("default"))
+			}
+		}
+		if len(p.Validation) == 1 {
+			if err := p.Validation[0].Valid(p.Type, rule.Default); err != nil {
+				return withPath(diag.FromErr(err), path.GetAttr("default"))
+			}
+		}
+	}
+	return nil
+}
+
+// unavailableOption returns an option selected by value whose conditions
+// don't hold.
+func (p *Parameter) unavailableOption(value string, lookup func(name string) (string, bool)) (string, bool) {
+	selected := []string{value}
+	if p.Type == "list(string)" {
+		selected = nil
+		_ = json.Unmarshal([]byte(value), &selected)
+	}
+	for _, option := range p.Option {
+		if slices.Contains(selected, option.Value) && !holdAll(option.Condition, lookup) {
+			return option.Value, true
+		}
+	}
+	return "", false
+}
+
+// parameterForm is the definition of a parameter Coder evaluates as users
+// fill in the form.
+type parameterForm struct {
+	Version      int                  `json:"version"`
+	Name         string               `json:"name"`
+	Type         string               `json:"type"`
+	FormType     string               `json:"form_type,omitempty"`
+	Default      string               `json:"default"`
+	Visible      bool                 `json:"visible"`
+	Conditions   []ParameterCondition `json:"conditions"`
+	DefaultRules []DefaultRule        `json:"default_rules"`
+	Options      []parameterFormItem  `json:"options"`
+}
+
+type parameterFormItem struct {
+	Value      string               `json:"value"`
+	Conditions []ParameterCondition `json:"conditions"`
+}
+
+// form encodes the definition of the parameter in the form.
+func (p *Parameter) form(visible bool) (string, error) {
+	form := parameterForm{
+		Version:      1,
+		Name:         p.Name,
+		Type:         p.Type,
+		FormType:     p.FormType,
+		Default:      p.Default,
+		Visible:      visible,
+		Conditions:   p.Condition,
+		DefaultRules: p.DefaultRule,
+		Options:      make([]parameterFormItem, 0, len(p.Option)),
+	}
+	if form.Conditions == nil {
+		form.Conditions = []ParameterCondition{}
+	}
+	if form.DefaultRules == nil {
+		form.DefaultRules = []DefaultRule{}
+	}
+	for _, option := range p.Option {
+		conditions := option.Condition
+		if conditions == nil {
+			conditions = []ParameterCondition{}
+		}
+		form.Options = append(form.Options, parameterFormItem{Value: option.Value, Conditions: conditions})
+	}
+	data, err := json.Marshal(form)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// cost returns the cost of the options selected by value.
+func (p *Parameter) cost(value string) int {
+	selected := []string{value}
+	if p.Type == "list(string)" {
+		selected = nil
+		_ = json.Unmarshal([]byte(value), &selected)
+	}
+	cost := 0
+	for _, option := range p.Option {
+		if slices.Contains(selected, option.Value) {
+			cost += option.Cost
+		}
+	}
+	return cost
+}
+
+// displayValue formats value the way the form shows it.
+func (p *Parameter) displayValue(value string) string {
+	if value == "" || p.Type != "number" {
+		return value
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	if p.DisplayMultiplier > 0 {
+		number /= p.DisplayMultiplier
+	}
+	display := strconv.FormatFloat(number, 'f', -1, 64)
+	if p.Unit != "" {
+		display += " " + p.Unit
+	}
+	return display
+}
+
 func takeFirstError(errs ...error) error {
 	for _, err := range errs {
 		if err != nil {
@@ -1,8 +1,15 @@
 package provider_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coder/terraform-provider-coder/provider"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
@@ -304,6 +311,38 @@ func TestParameter(t *testing.T) {
 			}
 			`,
 		ExpectError: regexp.MustCompile("cannot have the same value"),
+	}, {
+		Name: "DuplicateOptionValueAndInvalidDefault",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "3"
+				option {
+					name = "1"
+					value = "1"
+				}
+				option {
+					name = "2"
+					value = "1"
+				}
+			}
+			`,
+		ExpectError: regexp.MustCompile("must be defined as one of options"),
+	}, {
+		Name: "DefaultFailsRegexValidation",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "us-east1"
+				validation {
+					regex = "^eu-"
+					error = "must be an EU region"
+				}
+			}
+			`,
+		ExpectError: regexp.MustCompile("must be an EU region"),
 	}, {
 		Name: "RequiredParameterNoDefault",
 		Config: `
@@ -390,6 +429,116 @@ data "coder_parameter" "region" {
 				require.Equal(t, expected, attributeValue)
 			}
 		},
+	}, {
+		Name: "ListOfStringsOptions",
+		Config: `
+			data "coder_parameter" "tools" {
+				name = "Tools"
+				type = "list(string)"
+				form_type = "multi-select"
+				default = jsonencode(["git", "docker"])
+				option {
+					name = "Git"
+					value = "git"
+				}
+				option {
+					name = "Docker"
+					value = "docker"
+					cost = 2
+				}
+				option {
+					name = "Terraform"
+					value = "terraform"
+					cost = 1
+				}
+			}`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, `["git","docker"]`, state.Primary.Attributes["value"])
+			require.Equal(t, "2", state.Primary.Attributes["cost"])
+		},
+	}, {
+		Name: "OptionCost",
+		Config: `
+			data "coder_parameter" "instance" {
+				name = "Instance"
+				default = "large"
+				option {
+					name = "Small"
+					value = "small"
+					cost = 2
+				}
+				option {
+					name = "Large"
+					value = "large"
+					cost = 8
+				}
+			}`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, "8", state.Primary.Attributes["option.1.cost"])
+			require.Equal(t, "8", state.Primary.Attributes["cost"])
+		},
+	}, {
+		Name: "ListOfStringsOptionsInvalidItem",
+		Config: `
+			data "coder_parameter" "tools" {
+				name = "Tools"
+				type = "list(string)"
+				default = jsonencode(["git", "curl"])
+				option {
+					name = "Git"
+					value = "git"
+				}
+			}`,
+		ExpectError: regexp.MustCompile(`contains "curl", which is not defined as one of options`),
+	}, {
+		Name: "MapOfStrings",
+		Config: `
+			data "coder_parameter" "labels" {
+				name = "Labels"
+				type = "map(string)"
+				default = jsonencode({ team = "platform" })
+				validation {
+					key_regex = "^[a-z]+$"
+					error = "labels must be lowercase"
+				}
+			}`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, "map(string)", state.Primary.Attributes["type"])
+			require.Equal(t, `{"team":"platform"}`, state.Primary.Attributes["value"])
+		},
+	}, {
+		Name: "MapOfStringsInvalidDefault",
+		Config: `
+			data "coder_parameter" "labels" {
+				name = "Labels"
+				type = "map(string)"
+				default = "team=platform"
+			}`,
+		ExpectError: regexp.MustCompile(`"team=platform" is not an object of strings`),
+	}, {
+		Name: "Timestamp",
+		Config: `
+			data "coder_parameter" "expiry" {
+				name = "Expiry"
+				type = "timestamp"
+				form_type = "datetime"
+				default = "2030-01-01T00:00:00Z"
+				validation {
+					min_timestamp = "2029-01-01T00:00:00Z"
+				}
+			}`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, "2030-01-01T00:00:00Z", state.Primary.Attributes["value"])
+		},
+	}, {
+		Name: "TimestampInvalid",
+		Config: `
+			data "coder_parameter" "expiry" {
+				name = "Expiry"
+				type = "timestamp"
+				default = "tomorrow"
+			}`,
+		ExpectError: regexp.MustCompile(`"tomorrow" is not an RFC 3339 timestamp`),
 	}, {
 		Name: "NumberValidation_Max",
 		Config: `
@@ -619,6 +768,151 @@ data "coder_parameter" "region" {
 			}
 			`,
 		ExpectError: regexp.MustCompile("is more than the maximum"),
+	}, {
+		Name: "NumberValidation_MinGreaterThanMax",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "number"
+				default = 4
+				validation {
+					min = 5
+					max = 3
+				}
+			}
+			`,
+		ExpectError: regexp.MustCompile("the minimum 5 cannot be greater than the maximum 3"),
+	}, {
+		Name: "NumberValidation_DefaultOutsideRange",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "number"
+				default = 8
+				validation {
+					min = 3
+					max = 5
+					error = "pick a smaller number"
+				}
+			}
+			`,
+		ExpectError: regexp.MustCompile("The default value 8 must be between 3 and 5"),
+	}, {
+		Name: "FormTypeSwitch",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "bool"
+				default = true
+				form_type = "switch"
+			}
+			`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, "switch", state.Primary.Attributes["form_type"])
+		},
+	}, {
+		Name: "FormTypeIncompatibleType",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "number"
+				default = 1
+				form_type = "textarea"
+			}
+			`,
+		ExpectError: regexp.MustCompile(`form_type "textarea" cannot be used with a number parameter`),
+	}, {
+		Name: "FormTypeDropdownWithoutOptions",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "us"
+				form_type = "dropdown"
+			}
+			`,
+		ExpectError: regexp.MustCompile(`form_type "dropdown" requires at least one option`),
+	}, {
+		Name: "TextareaLanguage",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "#cloud-config"
+				form_type = "textarea"
+				language = "yaml"
+			}
+			`,
+		Check: func(state *terraform.ResourceState) {
+			require.Equal(t, "textarea", state.Primary.Attributes["form_type"])
+			require.Equal(t, "yaml", state.Primary.Attributes["language"])
+		},
+	}, {
+		Name: "LanguageWithoutTextarea",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "{}"
+				language = "json"
+			}
+			`,
+		ExpectError: regexp.MustCompile(`language can only be set when form_type is "textarea"`),
+	}, {
+		Name: "NumberUnit",
+		Config: `
+			data "coder_parameter" "memory" {
+				name = "Memory"
+				type = "number"
+				default = 8589934592
+				unit = "GiB"
+				display_multiplier = 1073741824
+			}
+			`,
+		Check: func(state *terraform.ResourceState) {
+			attrs := state.Primary.Attributes
+			require.Equal(t, "8589934592", attrs["value"])
+			require.Equal(t, "8 GiB", attrs["display_value"])
+		},
+	}, {
+		Name: "UnitWithoutNumber",
+		Config: `
+			data "coder_parameter" "memory" {
+				name = "Memory"
+				type = "string"
+				default = "8"
+				unit = "GB"
+			}
+			`,
+		ExpectError: regexp.MustCompile(`unit can only be set on "number" parameters`),
+	}, {
+		Name: "BoolLabels",
+		Config: `
+			data "coder_parameter" "wipe" {
+				name = "Wipe home"
+				type = "bool"
+				default = false
+				form_type = "switch"
+				true_label = "Wipe home volume"
+				false_label = "Keep home volume"
+			}
+			`,
+		Check: func(state *terraform.ResourceState) {
+			attrs := state.Primary.Attributes
+			require.Equal(t, "Wipe home volume", attrs["true_label"])
+			require.Equal(t, "Keep home volume", attrs["false_label"])
+		},
+	}, {
+		Name: "LabelsWithoutBool",
+		Config: `
+			data "coder_parameter" "region" {
+				name = "Region"
+				type = "string"
+				default = "us"
+				false_label = "No"
+			}
+			`,
+		ExpectError: regexp.MustCompile(`false_label can only be set on "bool" parameters`),
 	}, {
 		Name: "NumberValidation_BoolWithMin",
 		Config: `
@@ -683,6 +977,470 @@ data "coder_parameter" "region" {
 	}
 }
 
+func TestParameterMany(t *testing.T) {
+	t.Parallel()
+
+	var config strings.Builder
+	config.WriteString(`provider "coder" {}`)
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&config, `
+			data "coder_parameter" "p%[1]d" {
+				name = "Parameter %[1]d"
+				type = "string"
+				default = "value-%[1]d"
+				validation {
+					regex = "^value-[0-9]+$"
+					error = "must be a value"
+				}
+			}`, i)
+	}
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config.String(),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 200)
+				param := state.Modules[0].Resources["data.coder_parameter.p199"]
+				require.NotNil(t, param)
+				require.Equal(t, "value-199", param.Primary.Attributes["value"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestParameterOptionsFile(t *testing.T) {
+	t.Parallel()
+
+	options := make([]provider.Option, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		options = append(options, provider.Option{
+			Name:  fmt.Sprintf("Instance %d", i),
+			Value: fmt.Sprintf("instance-%d", i),
+		})
+	}
+	data, err := json.Marshal(options)
+	require.NoError(t, err)
+	optionsFile := filepath.Join(t.TempDir(), "options.json")
+	require.NoError(t, os.WriteFile(optionsFile, data, 0o600))
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {}
+			data "coder_parameter" "instance" {
+				name = "instance"
+				type = "string"
+				form_type = "dropdown"
+				default = "instance-999"
+				options_file = %q
+			}
+			`, optionsFile),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				param := state.Modules[0].Resources["data.coder_parameter.instance"]
+				require.NotNil(t, param)
+				require.Equal(t, "instance-999", param.Primary.Attributes["value"])
+				require.Equal(t, "0", param.Primary.Attributes["option.#"])
+				var got []provider.Option
+				require.NoError(t, json.Unmarshal([]byte(param.Primary.Attributes["options_json"]), &got))
+				require.Equal(t, options, got)
+				return nil
+			},
+		}, {
+			Config: fmt.Sprintf(`
+			provider "coder" {}
+			data "coder_parameter" "instance" {
+				name = "instance"
+				type = "string"
+				default = "instance-1000"
+				options_file = %q
+			}
+			`, optionsFile),
+			ExpectError: regexp.MustCompile(`default value "instance-1000" must be defined as one of options`),
+		}, {
+			Config: fmt.Sprintf(`
+			provider "coder" {}
+			data "coder_parameter" "instance" {
+				name = "instance"
+				type = "number"
+				options_file = %q
+			}
+			`, optionsFile),
+			ExpectError: regexp.MustCompile(`is not a number`),
+		}},
+	})
+}
+
+func TestParameterComputed(t *testing.T) {
+	t.Setenv(provider.ParameterEnvironmentVariable("cpu"), "4")
+	// Computed parameters can't be overridden.
+	t.Setenv(provider.ParameterEnvironmentVariable("memory"), "1")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "cpu" {
+				name = "cpu"
+				type = "number"
+				default = 2
+				mutable = true
+			}
+			data "coder_parameter" "memory" {
+				name = "memory"
+				type = "number"
+				default = data.coder_parameter.cpu.value * 4
+				mutable = true
+				computed = true
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				param := state.Modules[0].Resources["data.coder_parameter.memory"]
+				require.NotNil(t, param)
+				require.Equal(t, "16", param.Primary.Attributes["value"])
+				require.Equal(t, "true", param.Primary.Attributes["computed"])
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "memory" {
+				name = "memory"
+				type = "number"
+				computed = true
+			}
+			`,
+			ExpectError: regexp.MustCompile("computed parameters require a default"),
+		}},
+	})
+}
+
+func TestParameterOrderAfter(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "region" {
+				name = "region"
+				default = "us"
+				order = 10
+			}
+			data "coder_parameter" "zone" {
+				name = "zone"
+				default = "us-a"
+				order_after = data.coder_parameter.region.name
+			}
+			data "coder_parameter" "instance" {
+				name = "instance"
+				default = "small"
+				order_after = data.coder_parameter.zone.name
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				for address, expected := range map[string]string{
+					"data.coder_parameter.region":   "10",
+					"data.coder_parameter.zone":     "11",
+					"data.coder_parameter.instance": "12",
+				} {
+					param := state.Modules[0].Resources[address]
+					require.NotNil(t, param, address)
+					require.Equal(t, expected, param.Primary.Attributes["order"], address)
+				}
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "zone" {
+				name = "zone"
+				default = "us-a"
+				order_after = "region"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`order_after references parameter "region", which hasn't been read`),
+		}},
+	})
+}
+
+func TestParameterConditions(t *testing.T) {
+	t.Setenv(provider.ParameterEnvironmentVariable("gpu"), "false")
+	// Hidden parameters ignore the submitted value.
+	t.Setenv(provider.ParameterEnvironmentVariable("gpu_type"), "a100")
+	t.Setenv(provider.ParameterEnvironmentVariable("size"), "large")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "gpu" {
+				name = "gpu"
+				type = "bool"
+				default = true
+			}
+			data "coder_parameter" "gpu_type" {
+				name = "gpu_type"
+				default = "none"
+				condition {
+					parameter = data.coder_parameter.gpu.name
+					values = ["true"]
+				}
+			}
+			data "coder_parameter" "size" {
+				name = "size"
+				default = "small"
+			}
+			data "coder_parameter" "memory" {
+				name = "memory"
+				type = "number"
+				default = 4
+				default_rule {
+					parameter = data.coder_parameter.size.name
+					values = ["large", "xlarge"]
+					default = 16
+				}
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				gpuType := state.Modules[0].Resources["data.coder_parameter.gpu_type"]
+				require.NotNil(t, gpuType)
+				require.Equal(t, "false", gpuType.Primary.Attributes["visible"])
+				require.Equal(t, "none", gpuType.Primary.Attributes["value"])
+
+				memory := state.Modules[0].Resources["data.coder_parameter.memory"]
+				require.NotNil(t, memory)
+				require.Equal(t, "true", memory.Primary.Attributes["visible"])
+				require.Equal(t, "16", memory.Primary.Attributes["value"])
+				require.JSONEq(t, `{
+					"version": 1,
+					"name": "memory",
+					"type": "number",
+					"default": "4",
+					"visible": true,
+					"conditions": [],
+					"default_rules": [{"parameter": "size", "values": ["large", "xlarge"], "default": "16"}],
+					"options": []
+				}`, memory.Primary.Attributes["form"])
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "size" {
+				name = "size"
+				default = "small"
+				option {
+					name = "Small"
+					value = "small"
+				}
+				option {
+					name = "Large"
+					value = "large"
+					condition {
+						parameter = "gpu"
+						values = ["true"]
+					}
+				}
+			}
+			`,
+			ExpectError: regexp.MustCompile(`option "large" of parameter "size" isn't available`),
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "memory" {
+				name = "memory"
+				type = "number"
+				default_rule {
+					parameter = "size"
+					values = ["large"]
+					default = 16
+				}
+			}
+			`,
+			ExpectError: regexp.MustCompile("default_rule requires a default"),
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "memory" {
+				name = "memory"
+				type = "number"
+				default = 4
+				default_rule {
+					parameter = "size"
+					values = ["large"]
+					default = "lots"
+				}
+			}
+			`,
+			ExpectError: regexp.MustCompile("is not a number"),
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "size" {
+				name = "size"
+				default = "small"
+				condition {
+					parameter = "size"
+					values = ["large"]
+				}
+			}
+			`,
+			ExpectError: regexp.MustCompile("a parameter can't depend on itself"),
+		}},
+	})
+}
+
+func TestParameterVariable(t *testing.T) {
+	// The provider reads variables from its working directory, which is
+	// the template directory when run by Terraform.
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(`
+variable "region" {
+  type        = string
+  description = "Where to deploy the workspace."
+  default     = "us-east-1"
+}
+
+variable "regions" {
+  type    = list(string)
+  default = ["us-east-1", "eu-west-1"]
+}
+
+variable "replicas" {
+  type = number
+}
+
+variable "tags" {
+  type = object({ team = string })
+}
+`), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "generated.tf.json"), []byte(`{
+  "variable": {
+    "disk_size": {
+      "type": "number",
+      "description": "The size of the home disk in GB.",
+      "default": 20
+    }
+  }
+}
+`), 0o600)
+	require.NoError(t, err)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "region" {
+				name = "region"
+				variable = "region"
+			}
+			data "coder_parameter" "disk_size" {
+				name = "disk_size"
+				variable = "disk_size"
+			}
+			data "coder_parameter" "regions" {
+				name = "regions"
+				variable = "regions"
+				description = "Where to replicate the workspace."
+			}
+			data "coder_parameter" "replicas" {
+				name = "replicas"
+				variable = "replicas"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				region := state.Modules[0].Resources["data.coder_parameter.region"].Primary.Attributes
+				require.Equal(t, "string", region["type"])
+				require.Equal(t, "Where to deploy the workspace.", region["description"])
+				require.Equal(t, "us-east-1", region["default"])
+				require.Equal(t, "us-east-1", region["value"])
+				require.Equal(t, "true", region["optional"])
+
+				regions := state.Modules[0].Resources["data.coder_parameter.regions"].Primary.Attributes
+				require.Equal(t, "list(string)", regions["type"])
+				require.Equal(t, "Where to replicate the workspace.", regions["description"])
+				require.Equal(t, `["us-east-1","eu-west-1"]`, regions["default"])
+
+				replicas := state.Modules[0].Resources["data.coder_parameter.replicas"].Primary.Attributes
+				require.Equal(t, "number", replicas["type"])
+				require.Equal(t, "false", replicas["optional"])
+
+				diskSize := state.Modules[0].Resources["data.coder_parameter.disk_size"].Primary.Attributes
+				require.Equal(t, "number", diskSize["type"])
+				require.Equal(t, "The size of the home disk in GB.", diskSize["description"])
+				require.Equal(t, "20", diskSize["default"])
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "region" {
+				name = "region"
+				type = "number"
+				variable = "region"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`type "number" doesn't match the type "string" of variable "region"`),
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "zone" {
+				name = "zone"
+				variable = "zone"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`variable "zone" is not declared by the template`),
+		}, {
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "tags" {
+				name = "tags"
+				variable = "tags"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`type "object\({team=string}\)" can't be used for a parameter`),
+		}},
+	})
+}
+
 func TestValueValidatesType(t *testing.T) {
 	t.Parallel()
 	for _, tc := range []struct {
@@ -690,6 +1448,7 @@ func TestValueValidatesType(t *testing.T) {
 		Type,
 		Value,
 		Regex,
+		KeyRegex,
 		RegexError string
 		Min,
 		Max int
@@ -738,6 +1497,13 @@ func TestValueValidatesType(t *testing.T) {
 		Max:         1,
 		MinDisabled: true,
 		Error:       regexp.MustCompile("is more than the maximum 1"),
+	}, {
+		Name:  "NumberMinGreaterThanMax",
+		Type:  "number",
+		Value: "2",
+		Min:   3,
+		Max:   1,
+		Error: regexp.MustCompile("the minimum 3 cannot be greater than the maximum 1"),
 	}, {
 		Name:        "InvalidBool",
 		Type:        "bool",
@@ -795,6 +1561,48 @@ func TestValueValidatesType(t *testing.T) {
 		Value:       `[]`,
 		MinDisabled: true,
 		MaxDisabled: true,
+	}, {
+		Name:        "ValidMapOfStrings",
+		Type:        "map(string)",
+		Value:       `{"team":"platform","tier":"dev"}`,
+		KeyRegex:    `^[a-z]+$`,
+		Regex:       `^[a-z]+$`,
+		RegexError:  "must be a valid label",
+		MinDisabled: true,
+		MaxDisabled: true,
+	}, {
+		Name:        "InvalidMapOfStrings",
+		Type:        "map(string)",
+		Value:       `["team"]`,
+		MinDisabled: true,
+		MaxDisabled: true,
+		Error:       regexp.MustCompile("is not valid map of strings"),
+	}, {
+		Name:        "MapOfStringsInvalidKey",
+		Type:        "map(string)",
+		Value:       `{"Team":"platform"}`,
+		KeyRegex:    `^[a-z]+$`,
+		RegexError:  "must be a valid label",
+		MinDisabled: true,
+		MaxDisabled: true,
+		Error:       regexp.MustCompile(`must be a valid label \(key "Team" does not match`),
+	}, {
+		Name:        "MapOfStringsInvalidValue",
+		Type:        "map(string)",
+		Value:       `{"team":"Platform"}`,
+		Regex:       `^[a-z]+$`,
+		RegexError:  "must be a valid label",
+		MinDisabled: true,
+		MaxDisabled: true,
+		Error:       regexp.MustCompile(`value "Platform" of key "team" does not match`),
+	}, {
+		Name:        "StringWithKeyRegex",
+		Type:        "string",
+		Value:       "platform",
+		KeyRegex:    `^[a-z]+$`,
+		MinDisabled: true,
+		MaxDisabled: true,
+		Error:       regexp.MustCompile("a key_regex cannot be specified for a string type"),
 	}} {
 		tc := tc
 		t.Run(tc.Name, func(t *testing.T) {
@@ -806,6 +1614,7 @@ func TestValueValidatesType(t *testing.T) {
 				MaxDisabled: tc.MaxDisabled,
 				Monotonic:   tc.Monotonic,
 				Regex:       tc.Regex,
+				KeyRegex:    tc.KeyRegex,
 				Error:       tc.RegexError,
 			}
 			err := v.Valid(tc.Type, tc.Value)
@@ -818,3 +1627,138 @@ func TestValueValidatesType(t *testing.T) {
 		})
 	}
 }
+
+func TestValidationTimestamp(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	for _, tc := range []struct {
+		Name       string
+		Value      time.Time
+		Validation provider.Validation
+		Error      *regexp.Regexp
+	}{{
+		Name:  "WithinAbsolute",
+		Value: time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC),
+		Validation: provider.Validation{
+			MinTimestamp: "2030-01-01T00:00:00Z",
+			MaxTimestamp: "2030-12-31T00:00:00Z",
+		},
+	}, {
+		Name:  "BeforeAbsolute",
+		Value: time.Date(2029, 6, 1, 0, 0, 0, 0, time.UTC),
+		Validation: provider.Validation{
+			MinTimestamp: "2030-01-01T00:00:00Z",
+		},
+		Error: regexp.MustCompile("value 2029-06-01T00:00:00Z is before 2030-01-01T00:00:00Z"),
+	}, {
+		Name:  "WithinRelative",
+		Value: now.Add(7 * 24 * time.Hour),
+		Validation: provider.Validation{
+			MinFromNow: "0s",
+			MaxFromNow: "720h",
+		},
+	}, {
+		Name:  "AfterRelative",
+		Value: now.Add(31 * 24 * time.Hour),
+		Validation: provider.Validation{
+			MaxFromNow: "720h",
+			Error:      "expiry must be within 30 days, got {value}",
+		},
+		Error: regexp.MustCompile("expiry must be within 30 days, got "),
+	}, {
+		Name:  "InPast",
+		Value: now.Add(-time.Hour),
+		Validation: provider.Validation{
+			MinFromNow: "0s",
+		},
+		Error: regexp.MustCompile("is before"),
+	}} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			v := tc.Validation
+			v.MinDisabled = true
+			v.MaxDisabled = true
+			err := v.Valid("timestamp", tc.Value.Format(time.RFC3339))
+			if tc.Error != nil {
+				require.Error(t, err)
+				require.Regexp(t, tc.Error, err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// FuzzValidation asserts that Valid never panics, and only accepts values
+// that satisfy the validation.
+func FuzzValidation(f *testing.F) {
+	for _, seed := range []struct {
+		typ, value, regex, monotonic string
+		min, max                     int
+		minDisabled, maxDisabled     bool
+	}{
+		{"string", "hello", `^[a-z]+$`, "", 0, 0, true, true},
+		{"string", "", `(`, "", 0, 0, true, true},
+		{"number", "5", "", "increasing", 1, 10, false, false},
+		{"number", "-0", "", "decreasing", -1, 0, false, true},
+		{"number", "99999999999999999999", "", "", 0, 0, false, false},
+		{"bool", "true", "", "", 0, 0, true, true},
+		{"list(string)", `["a","b"]`, "", "", 0, 0, true, true},
+		{"list(string)", `[1,null]`, "", "", 0, 0, true, true},
+		{"map(string)", `{"a":"b"}`, `^b$`, "", 0, 0, true, true},
+		{"map(string)", `{"a":`, "", "", 0, 0, true, true},
+		{"timestamp", "2030-01-01T00:00:00Z", "", "", 0, 0, true, true},
+	} {
+		f.Add(seed.typ, seed.value, seed.regex, seed.monotonic, seed.min, seed.max, seed.minDisabled, seed.maxDisabled)
+	}
+	f.Fuzz(func(t *testing.T, typ, value, regex, monotonic string, min, max int, minDisabled, maxDisabled bool) {
+		v := &provider.Validation{
+			Min:         min,
+			MinDisabled: minDisabled,
+			Max:         max,
+			MaxDisabled: maxDisabled,
+			Monotonic:   monotonic,
+			Regex:       regex,
+			Error:       "invalid {value}",
+		}
+		err := v.Valid(typ, value)
+		require.Equal(t, err, v.Valid(typ, value), "validation is not deterministic")
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case "string":
+			if regex != "" {
+				require.Regexp(t, regexp.MustCompile(regex), value)
+			}
+		case "number":
+			num, err := strconv.Atoi(value)
+			require.NoError(t, err)
+			if !minDisabled {
+				require.GreaterOrEqual(t, num, min)
+			}
+			if !maxDisabled {
+				require.LessOrEqual(t, num, max)
+			}
+			require.Contains(t, []string{"", provider.ValidationMonotonicIncreasing, provider.ValidationMonotonicDecreasing}, monotonic)
+		case "bool":
+			require.Contains(t, []string{"true", "false"}, value)
+		case "list(string)":
+			var items []string
+			require.NoError(t, json.Unmarshal([]byte(value), &items))
+		case "map(string)":
+			var items map[string]string
+			require.NoError(t, json.Unmarshal([]byte(value), &items))
+			if regex != "" {
+				for _, item := range items {
+					require.Regexp(t, regexp.MustCompile(regex), item)
+				}
+			}
+		case "timestamp":
+			_, err := time.Parse(time.RFC3339, value)
+			require.NoError(t, err)
+		}
+	})
+}
@@ -2,10 +2,15 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -14,11 +19,76 @@ import (
 
 type config struct {
 	URL *url.URL
+	// AppSlugs tracks the slugs used by "coder_app" resources for each agent.
+	AppSlugs *uniqueValues
+	// ScriptDisplayNames tracks the display names used by "coder_script"
+	// resources for each agent.
+	ScriptDisplayNames *uniqueValues
+	// Env is the environment injected by the provisioner, read once per
+	// provider instance.
+	Env environment
+	// AgentInstances tracks which agent each compute instance is bound to by
+	// "coder_agent_instance" resources.
+	AgentInstances *uniqueValues
+	// ParameterOrders records the order of each "coder_parameter" by name, so
+	// "order_after" can refer to parameters that were read before.
+	ParameterOrders *sync.Map
+	// ParameterValues records the value of each "coder_parameter" by name, so
+	// conditions can refer to parameters that were read before.
+	ParameterValues *sync.Map
+	// Variables returns the input variables declared by the template, parsed
+	// on first use.
+	Variables func() (map[string]terraformVariable, error)
+	// AgentEnv records the "env" of each "coder_agent" by ID, so "coder_env"
+	// resources can warn about the variables they override.
+	AgentEnv *sync.Map
+	// EnvNames tracks the variables set by "coder_env" resources for each
+	// agent.
+	EnvNames *uniqueValues
+	// Tasks tracks the "coder_task" resources, as only one is allowed per
+	// template.
+	Tasks *uniqueValues
+	// TerraformVersion is the version of Terraform running the provider, as
+	// reported by Terraform when configuring it.
+	TerraformVersion string
+}
+
+// uniqueValues records values that must be unique within a scope across all
+// resources planned by a single provider instance. Terraform configures a
+// fresh provider for every plan and apply, so values do not leak between runs.
+// Terraform plans resources concurrently, so all access goes through mu.
+type uniqueValues struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+func newUniqueValues() *uniqueValues {
+	return &uniqueValues{
+		values: map[string]map[string]string{},
+	}
+}
+
+// claim records that owner uses value within scope. If the value has already
+// been claimed by another owner, that owner is returned along with false.
+func (u *uniqueValues) claim(scope, value, owner string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	claimed, ok := u.values[scope]
+	if !ok {
+		claimed = map[string]string{}
+		u.values[scope] = claimed
+	}
+	if existing, ok := claimed[value]; ok {
+		return existing, false
+	}
+	claimed[value] = owner
+	return owner, true
 }
 
 // New returns a new Terraform provider.
 func New() *schema.Provider {
-	return &schema.Provider{
+	var p *schema.Provider
+	p = &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"url": {
 				Type:        schema.TypeString,
@@ -64,17 +134,36 @@ func New() *schema.Provider {
 				parsed.Host = rawHost
 			}
 			return config{
-				URL: parsed,
+				URL:                parsed,
+				AppSlugs:           newUniqueValues(),
+				ScriptDisplayNames: newUniqueValues(),
+				AgentInstances:     newUniqueValues(),
+				ParameterOrders:    &sync.Map{},
+				ParameterValues:    &sync.Map{},
+				AgentEnv:           &sync.Map{},
+				EnvNames:           newUniqueValues(),
+				Tasks:              newUniqueValues(),
+				TerraformVersion:   p.TerraformVersion,
+				Variables: sync.OnceValues(func() (map[string]terraformVariable, error) {
+					return readTerraformVariables(".")
+				}),
+				Env: readEnvironment(),
 			}, nil
 		},
 		DataSourcesMap: map[string]*schema.Resource{
-			"coder_workspace":       workspaceDataSource(),
-			"coder_workspace_tags":  workspaceTagDataSource(),
-			"coder_provisioner":     provisionerDataSource(),
-			"coder_parameter":       parameterDataSource(),
-			"coder_git_auth":        gitAuthDataSource(),
-			"coder_external_auth":   externalAuthDataSource(),
-			"coder_workspace_owner": workspaceOwnerDataSource(),
+			"coder_workspace":             workspaceDataSource(),
+			"coder_workspace_tags":        workspaceTagDataSource(),
+			"coder_provisioner":           provisionerDataSource(),
+			"coder_parameter":             parameterDataSource(),
+			"coder_git_auth":              gitAuthDataSource(),
+			"coder_external_auth":         externalAuthDataSource(),
+			"coder_workspace_owner":       workspaceOwnerDataSource(),
+			"coder_icons":                 iconsDataSource(),
+			"coder_token_exchange":        tokenExchangeDataSource(),
+			"coder_vault_token":           vaultTokenDataSource(),
+			"coder_gcp_workload_identity": gcpWorkloadIdentityDataSource(),
+			"coder_deployment":            deploymentDataSource(),
+			"coder_template_versions":     templateVersionsDataSource(),
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"coder_agent":          agentResource(),
@@ -83,8 +172,47 @@ func New() *schema.Provider {
 			"coder_metadata":       metadataResource(),
 			"coder_script":         scriptResource(),
 			"coder_env":            envResource(),
+			"coder_task":           taskResource(),
 		},
 	}
+	return p
+}
+
+// dataSourceIDNamespace namespaces the IDs derived by deterministicID.
+var dataSourceIDNamespace = uuid.MustParse("0d5b9c8e-3f4a-4e8b-9a57-6c1f2d3e4b5a")
+
+// deterministicID derives a UUID from what a data source read, so reading
+// the same values yields the same ID. Random IDs would change on every
+// refresh and make anything referencing them unknown until apply.
+func deterministicID(kind string, parts ...string) string {
+	return uuid.NewSHA1(dataSourceIDNamespace, []byte(kind+"\x00"+strings.Join(parts, "\x00"))).String()
+}
+
+// environment is a snapshot of the CODER_* variables the provisioner
+// injects. Data sources read from it instead of the process environment so
+// templates instantiating them in many modules don't rescan it each time.
+type environment map[string]string
+
+func readEnvironment() environment {
+	env := environment{}
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, "CODER_") {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// Get returns the value of the variable, or an empty string if it's unset.
+func (e environment) Get(name string) string {
+	return e[name]
+}
+
+// Lookup returns the value of the variable and whether it's set.
+func (e environment) Lookup(name string) (string, bool) {
+	value, ok := e[name]
+	return value, ok
 }
 
 // populateIsNull reads the raw plan for a coder_metadata resource being created,
@@ -104,8 +232,8 @@ func populateIsNull(resourceData *schema.ResourceData) (result interface{}, err
 	rawPlan := resourceData.GetRawPlan()
 	items := rawPlan.GetAttr("item").AsValueSlice()
 
-	var resultItems []interface{}
-	itemKeys := map[string]struct{}{}
+	resultItems := make([]interface{}, 0, len(items))
+	itemKeys := make(map[string]struct{}, len(items))
 	for _, item := range items {
 		key := valueAsString(item.GetAttr("key"))
 		_, exists := itemKeys[key]
@@ -117,8 +245,13 @@ func populateIsNull(resourceData *schema.ResourceData) (result interface{}, err
 			"key":       key,
 			"value":     valueAsString(item.GetAttr("value")),
 			"sensitive": valueAsBool(item.GetAttr("sensitive")),
+			"hide":      valueAsBool(item.GetAttr("hide")),
+			"flatten":   valueAsBool(item.GetAttr("flatten")),
+			"order":     valueAsInt(item.GetAttr("order")),
 		}
-		if item.GetAttr("value").IsNull() {
+		// Flattened items are planned with "is_null" already set.
+		isNull := item.GetAttr("is_null")
+		if item.GetAttr("value").IsNull() || (isNull.IsKnown() && !isNull.IsNull() && isNull.True()) {
 			resultItem["is_null"] = true
 		}
 		resultItems = append(resultItems, resultItem)
@@ -137,6 +270,16 @@ func valueAsString(value cty.Value) string {
 	return value.AsString()
 }
 
+// valueAsInt takes a cty.Value that may be a number or null, and converts it
+// to a Go int, using zero for null like the SDK does.
+func valueAsInt(value cty.Value) int {
+	if value.IsNull() {
+		return 0
+	}
+	i, _ := value.AsBigFloat().Int64()
+	return int(i)
+}
+
 // valueAsString takes a cty.Value that may be a boolean or null, and converts it to either a Go bool
 // or a nil interface{}
 func valueAsBool(value cty.Value) interface{} {
@@ -146,6 +289,131 @@ func valueAsBool(value cty.Value) interface{} {
 	return value.True()
 }
 
+// suppressLineEndingDiff ignores changes that only convert between CRLF and
+// LF line endings, such as a script read with file() from a Windows checkout.
+// Otherwise the resource would be replaced whenever the template is pushed
+// from a different machine.
+func suppressLineEndingDiff(_, old, new string, _ *schema.ResourceData) bool {
+	return strings.ReplaceAll(old, "\r\n", "\n") == strings.ReplaceAll(new, "\r\n", "\n")
+}
+
+// suppressTrailingSlashDiff ignores changes that only add or remove trailing
+// slashes from a path, which refer to the same directory.
+func suppressTrailingSlashDiff(_, old, new string, _ *schema.ResourceData) bool {
+	trim := func(path string) string {
+		trimmed := strings.TrimRight(path, "/")
+		if trimmed == "" && path != "" {
+			return "/"
+		}
+		return trimmed
+	}
+	return trim(old) == trim(new)
+}
+
+// validateIcon ensures an icon can be rendered by the dashboard. Icons must be
+// a path on the Coder deployment (e.g. "/icon/code.svg" or "/emojis/1f4bb.png"),
+// a builtin icon name (e.g. "builtin:code"), an http(s):// URL, or an image
+// data URI. Plain http:// URLs are checked against the access URL by
+// validateIconHost, as the provider isn't configured yet.
+func validateIcon(i interface{}, key string) ([]string, []error) {
+	value, ok := i.(string)
+	if !ok {
+		return nil, []error{xerrors.Errorf("expected %q to be a string, got %T", key, i)}
+	}
+	if value == "" {
+		return nil, nil
+	}
+	invalid := xerrors.Errorf("invalid %s %q: must be a path such as \"/icon/code.svg\", an https:// URL, or a data URI", key, value)
+	switch {
+	case strings.HasPrefix(value, "builtin:"):
+		name := strings.TrimPrefix(value, "builtin:")
+		if name == "" {
+			return nil, []error{invalid}
+		}
+		// Coder ships more icons than are bundled here, so an unknown name
+		// may still exist on the deployment.
+		if _, ok := BuiltinIcons[name]; !ok {
+			return []string{fmt.Sprintf("%s %q: %q is not a known builtin icon, see the coder_icons data source for the icons available", key, value, name)}, nil
+		}
+		return nil, nil
+	case strings.HasPrefix(value, "data:"):
+		if !strings.HasPrefix(value, "data:image/") || !strings.Contains(value, ",") {
+			return nil, []error{xerrors.Errorf("invalid %s %q: data URIs must contain an image (data:image/...)", key, value)}
+		}
+		return nil, nil
+	case strings.HasPrefix(value, "//"):
+		return nil, []error{invalid}
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, []error{xerrors.Errorf("invalid %s %q: %w", key, value, err)}
+	}
+	switch {
+	case parsed.Scheme == "" && strings.HasPrefix(parsed.Path, "/"):
+		return nil, nil
+	case (parsed.Scheme == "https" || parsed.Scheme == "http") && parsed.Host != "":
+		return nil, nil
+	}
+	return nil, []error{invalid}
+}
+
+// validateIconHost rejects http:// icons, which browsers block on deployments
+// served over HTTPS. Icons served by the deployment itself, such as
+// "${data.coder_workspace.me.access_url}/icon/code.svg", use the same scheme
+// as the dashboard, and browsers treat loopback addresses as secure, which is
+// common for local development deployments.
+func validateIconHost(config config, key, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "http" {
+		return nil
+	}
+	if isLoopback(parsed.Hostname()) || strings.EqualFold(parsed.Host, config.URL.Host) {
+		return nil
+	}
+	return xerrors.Errorf("invalid %s %q: http:// icons are blocked by browsers on HTTPS deployments, use https:// or a path such as \"/icon/code.svg\"", key, value)
+}
+
+// planIcon checks the icon in key of a resource against the access URL once
+// it's known.
+func planIcon(rd *schema.ResourceDiff, config config, key string) error {
+	if !rd.NewValueKnown(key) {
+		return nil
+	}
+	icon, _ := rd.Get(key).(string)
+	return validateIconHost(config, key, icon)
+}
+
+// resolveIcon stores builtin icon names as the path the dashboard serves them
+// from, e.g. "builtin:code" as "/icon/code.svg".
+func resolveIcon(i interface{}) string {
+	value, _ := i.(string)
+	name, ok := strings.CutPrefix(value, "builtin:")
+	if !ok {
+		return value
+	}
+	if path, ok := BuiltinIcons[name]; ok {
+		return path
+	}
+	return "/icon/" + name + ".svg"
+}
+
+// validatePreviewImage ensures an image can be rendered by the dashboard,
+// like validateIcon. Builtin icons are too small to use as a preview.
+func validatePreviewImage(i interface{}, key string) ([]string, []error) {
+	if value, ok := i.(string); ok && strings.HasPrefix(value, "builtin:") {
+		return nil, []error{xerrors.Errorf("invalid %s %q: builtin icons can't be used as images", key, value)}
+	}
+	return validateIcon(i, key)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // errorAsDiagnostic transforms a Go error to a diag.Diagnostics object representing a fatal error.
 func errorAsDiagnostics(err error) diag.Diagnostics {
 	return []diag.Diagnostic{{
@@ -1,8 +1,20 @@
 package provider_test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/go-cty/cty"
+	ctyjson "github.com/hashicorp/go-cty/cty/json"
+	"github.com/hashicorp/go-cty/cty/msgpack"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
@@ -34,6 +46,9 @@ func TestProviderEmpty(t *testing.T) {
 			data "coder_provisioner" "me" {}
 			data "coder_workspace" "me" {}
 			data "coder_workspace_owner" "me" {}
+			data "coder_icons" "builtin" {}
+			data "coder_deployment" "me" {}
+			data "coder_template_versions" "recent" {}
 			data "coder_external_auth" "git" {
 				id = "git"
 			}
@@ -49,3 +64,380 @@ func TestProviderEmpty(t *testing.T) {
 		}},
 	})
 }
+
+// TestProviderParallelResources plans enough resources that Terraform creates
+// them concurrently. Run with -race to catch unsynchronized provider state.
+func TestProviderParallelResources(t *testing.T) {
+	t.Parallel()
+
+	const count = 60
+	var config strings.Builder
+	config.WriteString(`
+		provider "coder" {
+			url = "https://example.com"
+		}
+		resource "coder_agent" "dev" {
+			os = "linux"
+			arch = "amd64"
+		}`)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&config, `
+		resource "coder_app" "app%[1]d" {
+			agent_id = coder_agent.dev.id
+			slug = "app%[1]d"
+			url = "http://localhost:%[2]d"
+		}
+		resource "coder_script" "script%[1]d" {
+			agent_id = coder_agent.dev.id
+			display_name = "Script %[1]d"
+			script = "echo %[1]d"
+			run_on_start = true
+		}
+		resource "coder_env" "env%[1]d" {
+			agent_id = coder_agent.dev.id
+			name = "ENV_%[1]d"
+			value = "%[1]d"
+		}`, i, 8000+i)
+	}
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config.String(),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1+3*count)
+				agentID := state.Modules[0].Resources["coder_agent.dev"].Primary.ID
+				for i := 0; i < count; i++ {
+					for _, address := range []string{"coder_app.app%d", "coder_script.script%d", "coder_env.env%d"} {
+						resource := state.Modules[0].Resources[fmt.Sprintf(address, i)]
+						require.NotNil(t, resource)
+						require.Equal(t, agentID, resource.Primary.Attributes["agent_id"])
+					}
+				}
+				return nil
+			},
+		}},
+	})
+}
+
+// TestProviderUpgrade plans states created by the provider before any of the
+// attributes added since existed, as Terraform does on the first build after
+// the provider is upgraded, and fails if any resource would change. Resources
+// can't be updated, so any change replaces them, and with them the workspace.
+// The states in testdata/upgrade were applied from their configs with the
+// baseline provider.
+func TestProviderUpgrade(t *testing.T) {
+	t.Parallel()
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "upgrade", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+	for _, fixture := range fixtures {
+		fixture := fixture
+		typeName := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		t.Run(typeName, func(t *testing.T) {
+			t.Parallel()
+			content, err := os.ReadFile(fixture)
+			require.NoError(t, err)
+			var upgrade struct {
+				Config json.RawMessage `json:"config"`
+				State  json.RawMessage `json:"state"`
+			}
+			err = json.Unmarshal(content, &upgrade)
+			require.NoError(t, err)
+			prior, planned, replace := newTestServer(t).upgrade(typeName, upgrade.Config, upgrade.State)
+			require.Empty(t, replace, "upgrading would replace %s", typeName)
+			require.True(t, planned.RawEquals(prior), "upgrading would change %s:\nprior:   %#v\nplanned: %#v", typeName, prior, planned)
+		})
+	}
+}
+
+// BenchmarkProvider measures planning and applying templates with many
+// parameters, apps and scripts through the same gRPC server Terraform uses,
+// without the overhead of running Terraform itself.
+func BenchmarkProvider(b *testing.B) {
+	// The SDK logs each attribute it plans, drowning out the results.
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	for _, n := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("Parameters/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				server := newTestServer(b)
+				for j := 0; j < n; j++ {
+					server.read("coder_parameter", map[string]cty.Value{
+						"name":    cty.StringVal(fmt.Sprintf("param_%d", j)),
+						"type":    cty.StringVal("string"),
+						"default": cty.StringVal("value"),
+						"order":   cty.NumberIntVal(int64(j)),
+					})
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Apps/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				server := newTestServer(b)
+				agentID := server.agent()
+				for j := 0; j < n; j++ {
+					server.apply("coder_app", map[string]cty.Value{
+						"agent_id": agentID,
+						"slug":     cty.StringVal(fmt.Sprintf("app-%d", j)),
+						"url":      cty.StringVal(fmt.Sprintf("http://localhost:%d", 8000+j)),
+					})
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Scripts/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				server := newTestServer(b)
+				agentID := server.agent()
+				for j := 0; j < n; j++ {
+					server.apply("coder_script", map[string]cty.Value{
+						"agent_id":     agentID,
+						"display_name": cty.StringVal(fmt.Sprintf("Script %d", j)),
+						"script":       cty.StringVal("echo hello"),
+						"run_on_start": cty.True,
+					})
+				}
+			}
+		})
+	}
+}
+
+// testServer plans and applies resources, and reads data sources, with a
+// configured provider, as Terraform would during a workspace build.
+type testServer struct {
+	tb       testing.TB
+	provider *schema.Provider
+	server   *schema.GRPCProviderServer
+}
+
+func newTestServer(tb testing.TB) *testServer {
+	tb.Helper()
+	p := provider.New()
+	s := &testServer{tb: tb, provider: p, server: schema.NewGRPCProviderServer(p)}
+	resp, err := s.server.ConfigureProvider(context.Background(), &tfprotov5.ConfigureProviderRequest{
+		Config: s.encode(schema.InternalMap(p.Schema).CoreConfigSchema(), map[string]cty.Value{
+			"url": cty.StringVal("https://example.com"),
+		}),
+	})
+	s.check(resp.Diagnostics, err)
+	return s
+}
+
+// agent applies a "coder_agent" and returns its ID.
+func (s *testServer) agent() cty.Value {
+	return s.apply("coder_agent", map[string]cty.Value{
+		"os":   cty.StringVal("linux"),
+		"arch": cty.StringVal("amd64"),
+	}).GetAttr("id")
+}
+
+// apply validates, plans and applies a resource with the given attributes,
+// and returns its new state.
+func (s *testServer) apply(typeName string, attrs map[string]cty.Value) cty.Value {
+	s.tb.Helper()
+	ctx := context.Background()
+	block := s.provider.ResourcesMap[typeName].CoreConfigSchema()
+	config := s.encode(block, attrs)
+	validate, err := s.server.ValidateResourceTypeConfig(ctx, &tfprotov5.ValidateResourceTypeConfigRequest{
+		TypeName: typeName,
+		Config:   config,
+	})
+	s.check(validate.Diagnostics, err)
+	priorState := s.encodeValue(cty.NullVal(block.ImpliedType()))
+	plan, err := s.server.PlanResourceChange(ctx, &tfprotov5.PlanResourceChangeRequest{
+		TypeName:         typeName,
+		PriorState:       priorState,
+		ProposedNewState: config,
+		Config:           config,
+	})
+	s.check(plan.Diagnostics, err)
+	apply, err := s.server.ApplyResourceChange(ctx, &tfprotov5.ApplyResourceChangeRequest{
+		TypeName:       typeName,
+		PriorState:     priorState,
+		PlannedState:   plan.PlannedState,
+		Config:         config,
+		PlannedPrivate: plan.PlannedPrivate,
+	})
+	s.check(apply.Diagnostics, err)
+	state, err := msgpack.Unmarshal(apply.NewState.MsgPack, block.ImpliedType())
+	require.NoError(s.tb, err)
+	return state
+}
+
+// read validates and reads a data source with the given attributes.
+func (s *testServer) read(typeName string, attrs map[string]cty.Value) {
+	s.tb.Helper()
+	ctx := context.Background()
+	config := s.encode(s.provider.DataSourcesMap[typeName].CoreConfigSchema(), attrs)
+	validate, err := s.server.ValidateDataSourceConfig(ctx, &tfprotov5.ValidateDataSourceConfigRequest{
+		TypeName: typeName,
+		Config:   config,
+	})
+	s.check(validate.Diagnostics, err)
+	read, err := s.server.ReadDataSource(ctx, &tfprotov5.ReadDataSourceRequest{
+		TypeName: typeName,
+		Config:   config,
+	})
+	s.check(read.Diagnostics, err)
+}
+
+// upgrade upgrades and refreshes the raw state of a resource created by an
+// earlier version of the provider, then plans it with config, as Terraform
+// does on the first build after the provider is upgraded. It returns the
+// refreshed and planned states, and the paths that require replacing the
+// resource.
+func (s *testServer) upgrade(typeName string, config, rawState []byte) (cty.Value, cty.Value, []string) {
+	s.tb.Helper()
+	ctx := context.Background()
+	res := s.provider.ResourcesMap[typeName]
+	block := res.CoreConfigSchema()
+	upgraded, err := s.server.UpgradeResourceState(ctx, &tfprotov5.UpgradeResourceStateRequest{
+		TypeName: typeName,
+		Version:  int64(res.SchemaVersion),
+		RawState: &tfprotov5.RawState{JSON: rawState},
+	})
+	s.check(upgraded.Diagnostics, err)
+	read, err := s.server.ReadResource(ctx, &tfprotov5.ReadResourceRequest{
+		TypeName:     typeName,
+		CurrentState: upgraded.UpgradedState,
+	})
+	s.check(read.Diagnostics, err)
+	prior, err := msgpack.Unmarshal(read.NewState.MsgPack, block.ImpliedType())
+	require.NoError(s.tb, err)
+	configVal, err := ctyjson.Unmarshal(config, block.ImpliedType())
+	require.NoError(s.tb, err)
+	configVal = emptyBlocks(res.Schema, configVal)
+	plan, err := s.server.PlanResourceChange(ctx, &tfprotov5.PlanResourceChangeRequest{
+		TypeName:         typeName,
+		PriorState:       read.NewState,
+		ProposedNewState: s.encodeValue(proposedNewState(res.Schema, prior, configVal)),
+		Config:           s.encodeValue(configVal),
+		PriorPrivate:     read.Private,
+	})
+	s.check(plan.Diagnostics, err)
+	planned, err := msgpack.Unmarshal(plan.PlannedState.MsgPack, block.ImpliedType())
+	require.NoError(s.tb, err)
+	replace := make([]string, 0, len(plan.RequiresReplace))
+	for _, path := range plan.RequiresReplace {
+		replace = append(replace, path.String())
+	}
+	return prior, planned, replace
+}
+
+// emptyBlocks replaces the null nested blocks of config with empty ones, as
+// Terraform sends blocks that aren't in the configuration.
+func emptyBlocks(schemaMap map[string]*schema.Schema, config cty.Value) cty.Value {
+	values := config.AsValueMap()
+	for name, attr := range schemaMap {
+		elem, ok := attr.Elem.(*schema.Resource)
+		if !ok {
+			continue
+		}
+		value := values[name]
+		if value.IsNull() {
+			if value.Type().IsSetType() {
+				values[name] = cty.SetValEmpty(value.Type().ElementType())
+			} else {
+				values[name] = cty.ListValEmpty(value.Type().ElementType())
+			}
+			continue
+		}
+		blocks := make([]cty.Value, 0, value.LengthInt())
+		for it := value.ElementIterator(); it.Next(); {
+			_, block := it.Element()
+			blocks = append(blocks, emptyBlocks(elem.Schema, block))
+		}
+		if value.Type().IsSetType() {
+			values[name] = cty.SetVal(blocks)
+		} else {
+			values[name] = cty.ListVal(blocks)
+		}
+	}
+	return cty.ObjectVal(values)
+}
+
+// proposedNewState merges config into prior as Terraform does before
+// planning: computed attributes and blocks that aren't configured keep their
+// prior values, and so do the computed attributes of configured blocks.
+func proposedNewState(schemaMap map[string]*schema.Schema, prior, config cty.Value) cty.Value {
+	values := config.AsValueMap()
+	for name, value := range values {
+		attr, ok := schemaMap[name]
+		if !ok {
+			// "id" isn't part of the schema, and is always computed.
+			values[name] = prior.GetAttr(name)
+			continue
+		}
+		elem, isBlock := attr.Elem.(*schema.Resource)
+		priorValue := prior.GetAttr(name)
+		switch {
+		case !isBlock:
+			if value.IsNull() && attr.Computed {
+				values[name] = priorValue
+			}
+		case value.LengthInt() == 0:
+			if attr.Computed {
+				values[name] = priorValue
+			}
+		case !priorValue.IsNull() && priorValue.LengthInt() == value.LengthInt():
+			priorBlocks := priorValue.AsValueSlice()
+			blocks := make([]cty.Value, 0, len(priorBlocks))
+			for i, block := range value.AsValueSlice() {
+				blocks = append(blocks, proposedNewState(elem.Schema, priorBlocks[i], block))
+			}
+			if value.Type().IsSetType() {
+				values[name] = cty.SetVal(blocks)
+			} else {
+				values[name] = cty.ListVal(blocks)
+			}
+		}
+	}
+	return cty.ObjectVal(values)
+}
+
+// encode encodes attrs as a config of block, with every other attribute
+// null and every block empty, as Terraform sends it.
+func (s *testServer) encode(block interface {
+	ImpliedType() cty.Type
+}, attrs map[string]cty.Value) *tfprotov5.DynamicValue {
+	s.tb.Helper()
+	typ := block.ImpliedType()
+	values := make(map[string]cty.Value, len(typ.AttributeTypes()))
+	for name, attrType := range typ.AttributeTypes() {
+		switch {
+		case attrs[name] != cty.NilVal:
+			values[name] = attrs[name]
+		case attrType.IsListType() && attrType.ElementType().IsObjectType():
+			values[name] = cty.ListValEmpty(attrType.ElementType())
+		case attrType.IsSetType() && attrType.ElementType().IsObjectType():
+			values[name] = cty.SetValEmpty(attrType.ElementType())
+		default:
+			values[name] = cty.NullVal(attrType)
+		}
+	}
+	return s.encodeValue(cty.ObjectVal(values))
+}
+
+func (s *testServer) encodeValue(value cty.Value) *tfprotov5.DynamicValue {
+	s.tb.Helper()
+	encoded, err := msgpack.Marshal(value, value.Type())
+	require.NoError(s.tb, err)
+	return &tfprotov5.DynamicValue{MsgPack: encoded}
+}
+
+func (s *testServer) check(diags []*tfprotov5.Diagnostic, err error) {
+	s.tb.Helper()
+	require.NoError(s.tb, err)
+	for _, diag := range diags {
+		if diag.Severity == tfprotov5.DiagnosticSeverityError {
+			s.tb.Fatalf("%s: %s", diag.Summary, diag.Detail)
+		}
+	}
+}
@@ -2,9 +2,9 @@ package provider
 
 import (
 	"context"
+	"reflect"
 	"runtime"
 
-	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -13,13 +13,22 @@ func provisionerDataSource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this data source to get information about the Coder provisioner.",
 		ReadContext: func(c context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
-			rd.SetId(uuid.NewString())
-			rd.Set("os", runtime.GOOS)
-			rd.Set("arch", runtime.GOARCH)
+			arch := runtime.GOARCH
 			// Fix for #11782: if we're on 32-bit ARM, set arch to armv7.
-			if runtime.GOARCH == "arm" {
-				rd.Set("arch", "armv7")
+			if arch == "arm" {
+				arch = "armv7"
 			}
+			rd.SetId(deterministicID("provisioner", runtime.GOOS, arch))
+			rd.Set("os", runtime.GOOS)
+			rd.Set("arch", arch)
+
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			rd.Set("env", map[string]string(config.Env))
+			rd.Set("version", config.Env.Get("CODER_PROVISIONER_VERSION"))
+			rd.Set("terraform_version", config.TerraformVersion)
 
 			return nil
 		},
@@ -34,6 +43,28 @@ func provisionerDataSource() *schema.Resource {
 				Computed:    true,
 				Description: "The architecture of the host. This exposes `runtime.GOARCH` (see https://pkg.go.dev/runtime#pkg-constants).",
 			},
+			"version": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The version of the Coder provisioner running the build, such as \"v2.14.0\". " +
+					"Empty if the provisioner doesn't report it. Compare it in a precondition to fail with an actionable " +
+					"error on provisioners that are too old for the template.",
+			},
+			"terraform_version": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The version of Terraform running the build, such as \"1.9.2\".",
+			},
+			"env": {
+				Type:      schema.TypeMap,
+				Computed:  true,
+				Sensitive: true,
+				Description: "Every CODER_* environment variable the provider received from the provisioner, keyed by name. " +
+					"This includes secrets such as session tokens, so it is marked sensitive.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
 		},
 	}
 }
@@ -43,3 +43,87 @@ func TestProvisioner(t *testing.T) {
 	})
 }
 
+func TestProvisionerStableID(t *testing.T) {
+	t.Parallel()
+	var id string
+	step := resource.TestStep{
+		Config: `
+			provider "coder" {
+			}
+			data "coder_provisioner" "me" {
+			}`,
+		Check: func(state *terraform.State) error {
+			resource := state.Modules[0].Resources["data.coder_provisioner.me"]
+			require.NotNil(t, resource)
+			if id == "" {
+				id = resource.Primary.ID
+			}
+			require.Equal(t, id, resource.Primary.ID)
+			return nil
+		},
+	}
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps:      []resource.TestStep{step, step},
+	})
+}
+
+func TestProvisionerEnv(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_NAME", "dev")
+	t.Setenv("CODER_WORKSPACE_TRANSITION", "start")
+	t.Setenv("NOT_CODER_VARIABLE", "ignored")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_provisioner" "me" {
+			}`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_provisioner.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "dev", attribs["env.CODER_WORKSPACE_NAME"])
+				require.Equal(t, "start", attribs["env.CODER_WORKSPACE_TRANSITION"])
+				require.NotContains(t, attribs, "env.NOT_CODER_VARIABLE")
+				return nil
+			},
+		}},
+	})
+}
+
+func TestProvisionerVersion(t *testing.T) {
+	t.Setenv("CODER_PROVISIONER_VERSION", "v2.14.0")
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			data "coder_provisioner" "me" {
+			}`,
+			Check: func(state *terraform.State) error {
+				resource := state.Modules[0].Resources["data.coder_provisioner.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "v2.14.0", attribs["version"])
+				require.Regexp(t, `^\d+\.\d+\.\d+`, attribs["terraform_version"])
+				return nil
+			},
+		}},
+	})
+}
@@ -3,16 +3,80 @@ package provider
 import (
 	"context"
 	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
 )
 
 var ScriptCRONParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.DowOptional | cron.Descriptor)
 
+// scriptCRONNextRuns is the number of upcoming run times exposed in
+// "cron_next_runs".
+const scriptCRONNextRuns = 3
+
+// parseScriptCRON parses a cron expression, which may be prefixed with
+// "CRON_TZ=<location>" to run in a specific timezone.
+func parseScriptCRON(spec string) (cron.Schedule, error) {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if !strings.HasPrefix(spec, prefix) {
+			continue
+		}
+		location, _, found := strings.Cut(strings.TrimPrefix(spec, prefix), " ")
+		if !found {
+			return nil, xerrors.Errorf("cron expression %q is missing a schedule after the timezone", spec)
+		}
+		if _, err := time.LoadLocation(location); err != nil {
+			return nil, xerrors.Errorf("invalid timezone %q in cron expression %q: %w", location, spec, err)
+		}
+	}
+	schedule, err := ScriptCRONParser.Parse(spec)
+	if err != nil {
+		return nil, xerrors.Errorf("%s is not a valid cron expression: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// setScriptCRONNextRuns sets "cron_next_runs" to the upcoming runs of the
+// "cron" schedule of a script, from now. It's empty when the script has no
+// schedule, so the attribute is always known after apply.
+func setScriptCRONNextRuns(rd *schema.ResourceData) diag.Diagnostics {
+	nextRuns := make([]string, 0, scriptCRONNextRuns)
+	cron, _ := rd.Get("cron").(string)
+	if cron == "" {
+		err := rd.Set("cron_next_runs", nextRuns)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		return nil
+	}
+	schedule, err := parseScriptCRON(cron)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	next := time.Now()
+	for len(nextRuns) < scriptCRONNextRuns {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		nextRuns = append(nextRuns, next.Format(time.RFC3339))
+	}
+	err = rd.Set("cron_next_runs", nextRuns)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
 func scriptResource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this resource to run a script from an agent.",
@@ -29,10 +93,77 @@ func scriptResource() *schema.Resource {
 			if !runOnStart && startBlocksLogin {
 				return diag.Errorf("start_blocks_login can only be set if run_on_start is true")
 			}
-			return nil
+			if startTimeout, _ := rd.Get("start_timeout").(int); !runOnStart && startTimeout != 0 {
+				return diag.Errorf("start_timeout can only be set if run_on_start is true")
+			}
+			if stopTimeout, _ := rd.Get("stop_timeout").(int); !runOnStop && stopTimeout != 0 {
+				return diag.Errorf("stop_timeout can only be set if run_on_stop is true")
+			}
+			return setScriptCRONNextRuns(rd)
+		},
+		// States from before "cron_next_runs" existed don't have it, and it
+		// would be planned as a change the script can't be updated for. The
+		// runs aren't recomputed once set.
+		ReadContext: func(_ context.Context, rd *schema.ResourceData, _ interface{}) diag.Diagnostics {
+			if _, ok := rd.GetOk("cron_next_runs"); ok {
+				return nil
+			}
+			return setScriptCRONNextRuns(rd)
 		},
-		ReadContext:   schema.NoopContext,
 		DeleteContext: schema.NoopContext,
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			config, valid := i.(config)
+			if !valid {
+				return xerrors.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			if err := planIcon(rd, config, "icon"); err != nil {
+				return err
+			}
+			// Scripts loaded from a file are rendered at plan time so
+			// changes to the file show up as a diff.
+			source, _ := rd.Get("source").(string)
+			sourceURL, _ := rd.Get("source_url").(string)
+			switch {
+			case !rd.NewValueKnown("source_url"), sourceURL != "" && !rd.NewValueKnown("sha256"):
+				err := rd.SetNewComputed("script")
+				if err != nil {
+					return err
+				}
+			case sourceURL != "":
+				checksum, _ := rd.Get("sha256").(string)
+				err := rd.SetNew("script", scriptSourceURLScript(sourceURL, checksum))
+				if err != nil {
+					return err
+				}
+			case !rd.NewValueKnown("source"), source != "" && !rd.NewValueKnown("source_vars"):
+				err := rd.SetNewComputed("script")
+				if err != nil {
+					return err
+				}
+			case source != "":
+				vars, _ := rd.Get("source_vars").(map[string]interface{})
+				script, err := renderScriptSource(source, vars)
+				if err != nil {
+					return err
+				}
+				err = rd.SetNew("script", script)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Logs are grouped by display name in the dashboard, so scripts
+			// sharing one on the same agent would have their output merged.
+			if !rd.NewValueKnown("agent_id") || !rd.NewValueKnown("display_name") {
+				return nil
+			}
+			agentID, _ := rd.Get("agent_id").(string)
+			displayName, _ := rd.Get("display_name").(string)
+			if _, ok := config.ScriptDisplayNames.claim(agentID, displayName, displayName); !ok {
+				return xerrors.Errorf("duplicate coder_script display_name %q on agent %q: each script on an agent must have a unique display name", displayName, agentID)
+			}
+			return nil
+		},
 		Schema: map[string]*schema.Schema{
 			"agent_id": {
 				Type:        schema.TypeString,
@@ -59,30 +190,80 @@ func scriptResource() *schema.Resource {
 				Description: "A URL to an icon that will display in the dashboard. View built-in " +
 					"icons here: https://github.com/coder/coder/tree/main/site/static/icon. Use a " +
 					"built-in icon with `data.coder_workspace.me.access_url + \"/icon/<path>\"`.",
+				ValidateFunc: validateIcon,
+				StateFunc:    resolveIcon,
 			},
 			"script": {
-				ForceNew:    true,
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "The content of the script that will be run.",
+				ForceNew:         true,
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ExactlyOneOf:     []string{"script", "source", "source_url"},
+				DiffSuppressFunc: suppressLineEndingDiff,
+				Description: `The content of the script that will be run. When "source" is set, this is the rendered content of the file. ` +
+					`When "source_url" is set, this downloads and verifies the script before running it.`,
+			},
+			"source": {
+				ForceNew:     true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"script", "source", "source_url"},
+				Description: "The path of a file to load the script from, relative to the directory Terraform is run in. " +
+					"Tokens such as `{{ name }}` are replaced with the matching entry of \"source_vars\", while shell " +
+					"syntax such as `${HOME}` is left untouched. Changes to the file replace the script.",
+			},
+			"source_url": {
+				ForceNew:     true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"script", "source", "source_url"},
+				RequiredWith: []string{"sha256"},
+				Description: "The URL of the script to download and run in the workspace, such as a bootstrap script on an " +
+					"internal artifact store. The script is downloaded each time it runs with curl or wget, and isn't run " +
+					"unless it matches \"sha256\". Only supported on Linux and macOS.",
+				ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			},
+			"sha256": {
+				ForceNew:     true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"source_url"},
+				Description:  `The hex-encoded SHA-256 checksum of the script at "source_url".`,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[a-fA-F0-9]{64}$`), "must be a hex-encoded SHA-256 checksum"),
+			},
+			"source_vars": {
+				ForceNew:     true,
+				Type:         schema.TypeMap,
+				Optional:     true,
+				RequiredWith: []string{"source"},
+				Description:  "Values substituted for `{{ name }}` tokens in the \"source\" file.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
 			},
 			"cron": {
 				ForceNew:    true,
 				Type:        schema.TypeString,
 				Optional:    true,
-				Description: "The cron schedule to run the script on. This is a cron expression.",
+				Description: "The cron schedule to run the script on. This is a cron expression with a leading seconds field. Prefix the expression with \"CRON_TZ=<location>\" (e.g. \"CRON_TZ=Europe/Berlin 0 0 9 * * *\") to run in a specific timezone.",
 				ValidateFunc: func(i interface{}, _ string) ([]string, []error) {
 					v, ok := i.(string)
 					if !ok {
 						return []string{}, []error{fmt.Errorf("got type %T instead of string", i)}
 					}
-					_, err := ScriptCRONParser.Parse(v)
+					_, err := parseScriptCRON(v)
 					if err != nil {
-						return []string{}, []error{fmt.Errorf("%s is not a valid cron expression: %w", v, err)}
+						return []string{}, []error{err}
 					}
 					return nil, nil
 				},
 			},
+			"cron_next_runs": {
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+				Description: "The next three times the script will run on its \"cron\" schedule, formatted as RFC3339 timestamps. They're a snapshot taken when the script is created, or when the state of a script created by an earlier version of the provider is first refreshed, and aren't updated after that. Empty if \"cron\" isn't set.",
+			},
 			"start_blocks_login": {
 				Type:        schema.TypeBool,
 				Default:     false,
@@ -104,6 +285,24 @@ func scriptResource() *schema.Resource {
 				Optional:    true,
 				Description: "This option defines whether or not the script should run when the agent stops. The script should exit when it is done to signal that the workspace can be stopped.",
 			},
+			"working_directory": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Description: "The directory the script runs in, such as the path of a repository it operates on. " +
+					"Defaults to the \"dir\" of the agent.",
+				ValidateFunc:     validation.StringIsNotEmpty,
+				DiffSuppressFunc: suppressTrailingSlashDiff,
+			},
+			"run_as_user": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Description: "The user the agent runs the script as, such as \"root\" for scripts that install packages. " +
+					"Defaults to the user the agent runs as, which must be root to run scripts as other users. " +
+					"Only supported on Linux.",
+				ValidateFunc: validation.StringMatch(linuxUserNameRegex, "must be a valid Linux user name"),
+			},
 			"timeout": {
 				Type:         schema.TypeInt,
 				Default:      0,
@@ -112,6 +311,98 @@ func scriptResource() *schema.Resource {
 				Description:  "Time in seconds that the script is allowed to run. If the script does not complete within this time, the script is terminated and the agent lifecycle status is marked as timed out. A value of zero (default) means no timeout.",
 				ValidateFunc: validation.IntAtLeast(1),
 			},
+			"start_timeout": {
+				Type:         schema.TypeInt,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  `Time in seconds that the script is allowed to run when the agent starts, overriding "timeout". Requires "run_on_start".`,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"stop_timeout": {
+				Type:         schema.TypeInt,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  `Time in seconds that the script is allowed to run when the agent stops, overriding "timeout", so a hanging stop script doesn't hold up the workspace shutdown. Requires "run_on_stop".`,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"kill_grace_period": {
+				Type:         schema.TypeInt,
+				ForceNew:     true,
+				Optional:     true,
+				Description:  "Time in seconds between asking a timed out script to exit with SIGTERM and killing it with SIGKILL. A value of zero (default) uses the agent's default.",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
 		},
 	}
 }
+
+// scriptSourceTokenRegex matches "{{ name }}" tokens in a script source.
+// Other uses of braces, such as "{{.Names}}" in a docker format string,
+// are left untouched.
+var scriptSourceTokenRegex = regexp.MustCompile(`{{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*}}`)
+
+// renderScriptSource reads the script at path and substitutes its tokens
+// with vars. Referencing a variable that isn't set is an error so typos
+// don't silently end up in the script.
+//
+// Sources can be multi-megabyte bootstrap payloads, so the script is built
+// directly from the file contents rather than through intermediate copies.
+func renderScriptSource(path string, vars map[string]interface{}) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", xerrors.Errorf("read script source: %w", err)
+	}
+	matches := scriptSourceTokenRegex.FindAllSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return string(content), nil
+	}
+	var (
+		script  strings.Builder
+		missing []string
+		last    int
+	)
+	script.Grow(len(content))
+	for _, match := range matches {
+		script.Write(content[last:match[0]])
+		last = match[1]
+		name := string(content[match[2]:match[3]])
+		value, ok := vars[name].(string)
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		script.WriteString(value)
+	}
+	if len(missing) > 0 {
+		return "", xerrors.Errorf("script source %q references undefined source_vars: %s", path, strings.Join(missing, ", "))
+	}
+	script.Write(content[last:])
+	return script.String(), nil
+}
+
+// scriptSourceURLScript returns a script that downloads the script at
+// sourceURL, and runs it only if it matches checksum.
+func scriptSourceURLScript(sourceURL, checksum string) string {
+	quotedURL := "'" + strings.ReplaceAll(sourceURL, "'", `'\''`) + "'"
+	return fmt.Sprintf(`#!/bin/sh
+set -eu
+script=$(mktemp)
+trap 'rm -f "$script"' EXIT
+if command -v curl >/dev/null 2>&1; then
+	curl -fsSL -o "$script" %[1]s
+else
+	wget -q -O "$script" %[1]s
+fi
+if command -v sha256sum >/dev/null 2>&1; then
+	actual=$(sha256sum "$script" | cut -d ' ' -f 1)
+else
+	actual=$(shasum -a 256 "$script" | cut -d ' ' -f 1)
+fi
+if [ "$actual" != "%[2]s" ]; then
+	echo "The script downloaded from "%[1]s" has the checksum $actual instead of %[2]s" >&2
+	exit 1
+fi
+chmod +x "$script"
+"$script"
+`, quotedURL, strings.ToLower(checksum))
+}
@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderScriptSourceMemory ensures rendering a multi-megabyte source
+// holds no more than the file contents and the rendered script in memory.
+func TestRenderScriptSourceMemory(t *testing.T) {
+	payload := strings.Repeat("0123456789abcdef", 512*1024)
+	for name, content := range map[string]string{
+		"Tokens":   "#!/bin/sh\n# {{ version }}\n" + payload + "\n# {{ version }}\n",
+		"NoTokens": "#!/bin/sh\n" + payload + "\n",
+	} {
+		source := filepath.Join(t.TempDir(), "bootstrap.sh")
+		err := os.WriteFile(source, []byte(content), 0o600)
+		require.NoError(t, err)
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		script, err := renderScriptSource(source, map[string]interface{}{"version": "v1.2.3"})
+		runtime.ReadMemStats(&after)
+		require.NoError(t, err, name)
+		require.Equal(t, strings.ReplaceAll(content, "{{ version }}", "v1.2.3"), script, name)
+
+		// One copy read from the file and one for the script, with some
+		// slack for the matches and the runtime.
+		allocated := after.TotalAlloc - before.TotalAlloc
+		require.Less(t, allocated, uint64(2*len(content)+64*1024), name)
+	}
+}
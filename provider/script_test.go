@@ -1,8 +1,13 @@
 package provider_test
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coder/terraform-provider-coder/provider"
 	"github.com/stretchr/testify/require"
@@ -29,6 +34,8 @@ func TestScript(t *testing.T) {
 				display_name = "Hey"
 				script = "Wow"
 				cron = "* * * * *"
+				run_as_user = "root"
+				working_directory = "~/project"
 			}
 			`,
 			Check: func(state *terraform.State) error {
@@ -38,10 +45,13 @@ func TestScript(t *testing.T) {
 				require.NotNil(t, script)
 				t.Logf("script attributes: %#v", script.Primary.Attributes)
 				for key, expected := range map[string]string{
-					"agent_id":     "some id",
-					"display_name": "Hey",
-					"script":       "Wow",
-					"cron":         "* * * * *",
+					"agent_id":          "some id",
+					"display_name":      "Hey",
+					"script":            "Wow",
+					"cron":              "* * * * *",
+					"cron_next_runs.#":  "3",
+					"run_as_user":       "root",
+					"working_directory": "~/project",
 				} {
 					require.Equal(t, expected, script.Primary.Attributes[key])
 				}
@@ -134,3 +144,327 @@ func TestScriptStartBlocksLoginRequiresRunOnStart(t *testing.T) {
 		}},
 	})
 }
+
+func TestScriptDuplicateDisplayName(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "first" {
+				agent_id = "some id"
+				display_name = "Setup"
+				script = "Wow"
+				run_on_start = true
+			}
+			resource "coder_script" "second" {
+				agent_id = "some id"
+				display_name = "Setup"
+				script = "Wow"
+				run_on_stop = true
+			}
+			`,
+			ExpectError: regexp.MustCompile(`duplicate coder_script display_name "Setup" on agent "some id"`),
+		}},
+	})
+}
+
+func TestScriptCRONTimezone(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Hey"
+				script = "Wow"
+				cron = "CRON_TZ=Mars/Olympus 0 0 9 * * *"
+			}
+			`,
+			ExpectError: regexp.MustCompile(`invalid timezone "Mars/Olympus"`),
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Hey"
+				script = "Wow"
+				cron = "CRON_TZ=Europe/Berlin 0 0 9 * * *"
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				script := state.Modules[0].Resources["coder_script.example"]
+				require.NotNil(t, script)
+				require.Equal(t, "3", script.Primary.Attributes["cron_next_runs.#"])
+				next, err := time.Parse(time.RFC3339, script.Primary.Attributes["cron_next_runs.0"])
+				require.NoError(t, err)
+				berlin, err := time.LoadLocation("Europe/Berlin")
+				require.NoError(t, err)
+				require.Equal(t, 9, next.In(berlin).Hour())
+				return nil
+			},
+		}},
+	})
+}
+
+func TestScriptCRONNextRuns(t *testing.T) {
+	t.Parallel()
+
+	config := `
+	provider "coder" {
+	}
+	resource "coder_script" "scheduled" {
+		agent_id = "some id"
+		display_name = "Scheduled"
+		script = "Wow"
+		cron = "* * * * * *"
+	}
+	resource "coder_script" "unscheduled" {
+		agent_id = "some id"
+		display_name = "Unscheduled"
+		script = "Wow"
+		run_on_start = true
+	}
+	`
+	var created string
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				unscheduled := state.Modules[0].Resources["coder_script.unscheduled"]
+				require.NotNil(t, unscheduled)
+				require.Equal(t, "0", unscheduled.Primary.Attributes["cron_next_runs.#"])
+				scheduled := state.Modules[0].Resources["coder_script.scheduled"]
+				require.NotNil(t, scheduled)
+				created = scheduled.Primary.Attributes["cron_next_runs.0"]
+				require.NotEmpty(t, created)
+				return nil
+			},
+		}, {
+			// Runs every second, so the runs computed at creation have
+			// passed by the time the state is refreshed, but they're kept
+			// as a snapshot rather than causing a diff.
+			PreConfig: func() {
+				time.Sleep(2 * time.Second)
+			},
+			Config: config,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				script := state.Modules[0].Resources["coder_script.scheduled"]
+				require.NotNil(t, script)
+				require.Equal(t, created, script.Primary.Attributes["cron_next_runs.0"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestScriptSource(t *testing.T) {
+	t.Parallel()
+
+	source := filepath.Join(t.TempDir(), "setup.sh")
+	err := os.WriteFile(source, []byte("#!/bin/sh\necho \"${HOME}\" {{ greeting }}\ndocker ps --format '{{.Names}}'\n"), 0o600)
+	require.NoError(t, err)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Hey"
+				source = %q
+				run_on_start = true
+			}
+			`, source),
+			ExpectError: regexp.MustCompile(`references undefined source_vars: greeting`),
+		}, {
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Hey"
+				source = %q
+				source_vars = {
+					greeting = "hello"
+				}
+				run_on_start = true
+			}
+			`, source),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				script := state.Modules[0].Resources["coder_script.example"]
+				require.NotNil(t, script)
+				require.Equal(t, "#!/bin/sh\necho \"${HOME}\" hello\ndocker ps --format '{{.Names}}'\n", script.Primary.Attributes["script"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestScriptSourceLarge(t *testing.T) {
+	t.Parallel()
+
+	// A multi-megabyte payload, such as an embedded binary, with a token at
+	// either end.
+	payload := strings.Repeat("0123456789abcdef", 512*1024)
+	source := filepath.Join(t.TempDir(), "bootstrap.sh")
+	err := os.WriteFile(source, []byte("#!/bin/sh\n# {{ version }}\n"+payload+"\n# {{ version }}\n"), 0o600)
+	require.NoError(t, err)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			resource "coder_script" "bootstrap" {
+				agent_id = "some id"
+				display_name = "Bootstrap"
+				source = %q
+				source_vars = {
+					version = "v1.2.3"
+				}
+				run_on_start = true
+			}
+			`, source),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				script := state.Modules[0].Resources["coder_script.bootstrap"]
+				require.NotNil(t, script)
+				require.Equal(t, "#!/bin/sh\n# v1.2.3\n"+payload+"\n# v1.2.3\n", script.Primary.Attributes["script"])
+				return nil
+			},
+		}},
+	})
+}
+
+func TestScriptSourceURL(t *testing.T) {
+	t.Parallel()
+	checksum := strings.Repeat("ab", 32)
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Bootstrap"
+				source_url = "https://artifacts.example.com/bootstrap.sh"
+				sha256 = %q
+				run_on_start = true
+			}
+			`, checksum),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				script := state.Modules[0].Resources["coder_script.example"]
+				require.NotNil(t, script)
+				content := script.Primary.Attributes["script"]
+				require.Contains(t, content, "curl -fsSL -o \"$script\" 'https://artifacts.example.com/bootstrap.sh'")
+				require.Contains(t, content, fmt.Sprintf(`if [ "$actual" != "%s" ]; then`, checksum))
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = "some id"
+				display_name = "Bootstrap"
+				source_url = "https://artifacts.example.com/bootstrap.sh"
+				sha256 = "not a checksum"
+				run_on_start = true
+			}
+			`,
+			ExpectError: regexp.MustCompile("must be a hex-encoded SHA-256 checksum"),
+		}},
+	})
+}
+
+func TestScriptPhaseTimeouts(t *testing.T) {
+	t.Parallel()
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = ""
+				display_name = "Hey"
+				script = "Wow"
+				run_on_start = true
+				run_on_stop = true
+				start_timeout = 1800
+				stop_timeout = 30
+				kill_grace_period = 5
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				script := state.Modules[0].Resources["coder_script.example"]
+				require.NotNil(t, script)
+				for key, expected := range map[string]string{
+					"start_timeout":     "1800",
+					"stop_timeout":      "30",
+					"kill_grace_period": "5",
+				} {
+					require.Equal(t, expected, script.Primary.Attributes[key])
+				}
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {
+			}
+			resource "coder_script" "example" {
+				agent_id = ""
+				display_name = "Hey"
+				script = "Wow"
+				run_on_start = true
+				stop_timeout = 30
+			}
+			`,
+			ExpectError: regexp.MustCompile(`stop_timeout can only be set if run_on_stop is true`),
+		}},
+	})
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
+)
+
+// TaskPromptParameterName is the default name of the "coder_parameter"
+// holding the prompt of a "coder_task".
+const TaskPromptParameterName = "AI Prompt"
+
+// Environment variables a "coder_task" sets for the process running the task,
+// through its "env" attribute.
+const (
+	// TaskPromptEnvironmentVariable holds the prompt the task was created
+	// with.
+	TaskPromptEnvironmentVariable = "CODER_TASK_PROMPT"
+	// TaskStatusSlugEnvironmentVariable holds the slug of the app the task
+	// reports its status under, such as with "coder exp mcp".
+	TaskStatusSlugEnvironmentVariable = "CODER_MCP_APP_STATUS_SLUG"
+)
+
+func taskResource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this resource to declare a long-running task, such as an AI agent working on a prompt, so " +
+			"workspaces created from the template show up in Coder's Tasks UI. The task runs in an app on an agent, " +
+			"which is shown in the sidebar next to the task's status. The process running the task reports its " +
+			`progress through the agent, under the slug of that app, so pass "env" to it, for example with ` +
+			`"coder_env" resources. Only one task is allowed per template.`,
+		CreateContext: func(_ context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			rd.SetId(uuid.NewString())
+
+			var diags diag.Diagnostics
+			parameterName, _ := rd.Get("prompt_parameter").(string)
+			prompt, ok := parameterValue(config, parameterName)
+			if !ok {
+				diags = append(diags, diag.Diagnostic{
+					Severity: diag.Warning,
+					Summary:  "Task prompt parameter hasn't been read",
+					Detail: fmt.Sprintf("The coder_parameter %q hasn't been read, so the task has no prompt. Reference it as "+
+						"data.coder_parameter.<name>.name in \"prompt_parameter\", so it's read first.", parameterName),
+					AttributePath: cty.GetAttrPath("prompt_parameter"),
+				})
+			}
+			err := rd.Set("prompt", prompt)
+			if err != nil {
+				return append(diags, diag.FromErr(err)...)
+			}
+			appSlug, _ := rd.Get("app_slug").(string)
+			err = rd.Set("env", map[string]interface{}{
+				TaskPromptEnvironmentVariable:     prompt,
+				TaskStatusSlugEnvironmentVariable: appSlug,
+			})
+			if err != nil {
+				return append(diags, diag.FromErr(err)...)
+			}
+			return diags
+		},
+		ReadContext:   schema.NoopContext,
+		DeleteContext: schema.NoopContext,
+		CustomizeDiff: func(ctx context.Context, rd *schema.ResourceDiff, i interface{}) error {
+			config, valid := i.(config)
+			if !valid {
+				return xerrors.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+			// Like coder_app slugs, the check runs when the plan is
+			// refreshed during apply if the agent ID is still unknown.
+			if !rd.NewValueKnown("agent_id") || !rd.NewValueKnown("app_slug") {
+				return nil
+			}
+			agentID, _ := rd.Get("agent_id").(string)
+			appSlug, _ := rd.Get("app_slug").(string)
+			label := agentID + "/" + appSlug
+			if existing, ok := config.Tasks.claim("", "task", label); !ok && existing != label {
+				return xerrors.Errorf("only one coder_task is allowed per template: found tasks for the apps %q and %q", existing, label)
+			}
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"agent_id": {
+				Type:        schema.TypeString,
+				Description: `The "id" property of a "coder_agent" resource to associate with.`,
+				ForceNew:    true,
+				Required:    true,
+			},
+			"app_slug": {
+				Type: schema.TypeString,
+				Description: `The "slug" of a "coder_app" on the same agent to show in the sidebar of the task, such ` +
+					"as the chat interface of an AI agent. The task reports its status under this slug.",
+				ForceNew:     true,
+				Required:     true,
+				ValidateFunc: validation.StringMatch(appSlugRegex, "must be the slug of a coder_app"),
+			},
+			"prompt_parameter": {
+				Type: schema.TypeString,
+				Description: `The name of the "coder_parameter" users enter the prompt of the task in. Reference ` +
+					"it as `data.coder_parameter.<name>.name`, so it's read first.",
+				ForceNew: true,
+				Optional: true,
+				Default:  TaskPromptParameterName,
+			},
+			"prompt": {
+				Type:        schema.TypeString,
+				Description: `The prompt the task was created with: the value of "prompt_parameter".`,
+				Computed:    true,
+			},
+			"env": {
+				Type: schema.TypeMap,
+				Description: "The environment variables to set for the process running the task: " +
+					TaskPromptEnvironmentVariable + " with the prompt, and " + TaskStatusSlugEnvironmentVariable +
+					` with the slug the task reports its status under. Both use the reserved "CODER_" prefix, so ` +
+					`set "allow_reserved_name" when passing them to "coder_env" resources, or "allow_reserved_env" when ` +
+					`merging them into the "env" of a "coder_agent".`,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package provider_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/terraform-provider-coder/provider"
+)
+
+func TestTask(t *testing.T) {
+	t.Setenv(provider.ParameterEnvironmentVariable(provider.TaskPromptParameterName), "Fix the flaky tests")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_parameter" "prompt" {
+				name = "AI Prompt"
+				default = ""
+			}
+			resource "coder_task" "agent" {
+				agent_id = "dev"
+				app_slug = "agent"
+				prompt_parameter = data.coder_parameter.prompt.name
+			}
+			`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				task := state.Modules[0].Resources["coder_task.agent"]
+				require.NotNil(t, task)
+				for key, expected := range map[string]string{
+					"agent_id":                      "dev",
+					"app_slug":                      "agent",
+					"prompt_parameter":              "AI Prompt",
+					"prompt":                        "Fix the flaky tests",
+					"env.CODER_TASK_PROMPT":         "Fix the flaky tests",
+					"env.CODER_MCP_APP_STATUS_SLUG": "agent",
+				} {
+					require.Equal(t, expected, task.Primary.Attributes[key], key)
+				}
+				return nil
+			},
+		}, {
+			Config: `
+			provider "coder" {}
+			resource "coder_task" "a" {
+				agent_id = "dev"
+				app_slug = "a"
+			}
+			resource "coder_task" "b" {
+				agent_id = "dev"
+				app_slug = "b"
+			}
+			`,
+			ExpectError: regexp.MustCompile("only one coder_task is allowed per template"),
+		}, {
+			Config: `
+			provider "coder" {}
+			resource "coder_task" "agent" {
+				agent_id = "dev"
+				app_slug = "Not A Slug"
+			}
+			`,
+			ExpectError: regexp.MustCompile("must be the slug of a coder_app"),
+		}},
+	})
+}
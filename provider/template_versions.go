@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// templateVersion is a version of the template in
+// CODER_WORKSPACE_TEMPLATE_VERSIONS.
+type templateVersion struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	Active    bool      `json:"active"`
+}
+
+func templateVersionsDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to list the most recent versions of the workspace's template, for example " +
+			"to show a changelog in the workspace, or to tell users their workspace runs an outdated version.",
+		ReadContext: func(c context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			var versions []templateVersion
+			if raw := config.Env.Get("CODER_WORKSPACE_TEMPLATE_VERSIONS"); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &versions); err != nil {
+					return diag.Errorf("couldn't parse template versions %q: %s", raw, err)
+				}
+			}
+			sort.SliceStable(versions, func(i, j int) bool {
+				return versions[i].CreatedAt.After(versions[j].CreatedAt)
+			})
+
+			current := config.Env.Get("CODER_WORKSPACE_TEMPLATE_VERSION")
+			outdated := false
+			for _, version := range versions {
+				if version.Active && current != "" && version.Name != current {
+					outdated = true
+				}
+			}
+			_ = rd.Set("outdated", outdated)
+
+			limit, _ := rd.Get("limit").(int)
+			if len(versions) > limit {
+				versions = versions[:limit]
+			}
+			values := make([]map[string]interface{}, 0, len(versions))
+			for _, version := range versions {
+				createdAt := ""
+				if !version.CreatedAt.IsZero() {
+					createdAt = version.CreatedAt.UTC().Format(time.RFC3339)
+				}
+				values = append(values, map[string]interface{}{
+					"id":         version.ID,
+					"name":       version.Name,
+					"message":    version.Message,
+					"created_at": createdAt,
+					"active":     version.Active,
+					"current":    current != "" && version.Name == current,
+				})
+			}
+			_ = rd.Set("versions", values)
+
+			rd.SetId(deterministicID("template_versions", config.Env.Get("CODER_WORKSPACE_TEMPLATE_ID"), current))
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"limit": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      10,
+				Description:  "The maximum number of versions to list.",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"versions": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The versions of the template, newest first.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "UUID of the version.",
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of the version.",
+						},
+						"message": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The message the version was pushed with.",
+						},
+						"created_at": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "When the version was created, as an RFC 3339 timestamp.",
+						},
+						"active": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "Whether the version is the active version of the template, which new workspaces use.",
+						},
+						"current": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "Whether the version is the one the workspace is being built with.",
+						},
+					},
+				},
+			},
+			"outdated": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the workspace is being built with a version other than the active version of the template.",
+			},
+		},
+	}
+}
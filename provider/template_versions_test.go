@@ -0,0 +1,53 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/terraform-provider-coder/provider"
+)
+
+func TestTemplateVersions(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_TEMPLATE_VERSION", "v2")
+	t.Setenv("CODER_WORKSPACE_TEMPLATE_VERSIONS", `[
+		{"id": "11111111-1111-1111-1111-111111111111", "name": "v1", "message": "Initial version", "created_at": "2024-01-01T00:00:00Z"},
+		{"id": "33333333-3333-3333-3333-333333333333", "name": "v3", "message": "Upgrade Go", "created_at": "2024-03-01T00:00:00Z", "active": true},
+		{"id": "22222222-2222-2222-2222-222222222222", "name": "v2", "message": "Add code-server", "created_at": "2024-02-01T00:00:00Z"}
+	]`)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_template_versions" "recent" {
+				limit = 2
+			}`,
+			Check: func(state *terraform.State) error {
+				resource := state.Modules[0].Resources["data.coder_template_versions.recent"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "true", attribs["outdated"])
+				require.Equal(t, "2", attribs["versions.#"])
+				require.Equal(t, "v3", attribs["versions.0.name"])
+				require.Equal(t, "Upgrade Go", attribs["versions.0.message"])
+				require.Equal(t, "2024-03-01T00:00:00Z", attribs["versions.0.created_at"])
+				require.Equal(t, "true", attribs["versions.0.active"])
+				require.Equal(t, "false", attribs["versions.0.current"])
+				require.Equal(t, "v2", attribs["versions.1.name"])
+				require.Equal(t, "22222222-2222-2222-2222-222222222222", attribs["versions.1.id"])
+				require.Equal(t, "false", attribs["versions.1.active"])
+				require.Equal(t, "true", attribs["versions.1.current"])
+				return nil
+			},
+		}},
+	})
+}
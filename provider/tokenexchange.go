@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
+)
+
+// tokenExchangeSubjects maps the identities that can be exchanged to the
+// environment variable holding them and their RFC 8693 token type.
+var tokenExchangeSubjects = map[string][2]string{
+	"oidc_id_token":     {"CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN", "urn:ietf:params:oauth:token-type:id_token"},
+	"oidc_access_token": {"CODER_WORKSPACE_OWNER_OIDC_ACCESS_TOKEN", "urn:ietf:params:oauth:token-type:access_token"},
+}
+
+// identityRequestTimeout bounds requests that trade the owner's identity
+// for credentials, so a slow endpoint doesn't stall the build.
+const identityRequestTimeout = 30 * time.Second
+
+func tokenExchangeDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to exchange the workspace owner's OpenID Connect identity for a scoped " +
+			"token from an OAuth 2.0 token exchange (RFC 8693) endpoint, such as those offered by Artifactory or " +
+			"Nexus. This avoids baking static registry credentials into templates.",
+		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			rd.SetId(uuid.NewString())
+
+			subject, _ := rd.Get("subject_token").(string)
+			subjectToken := config.Env.Get(tokenExchangeSubjects[subject][0])
+			if subjectToken == "" {
+				// The owner didn't authenticate with OpenID Connect, or the
+				// template is being imported without a workspace.
+				_ = rd.Set("access_token", "")
+				_ = rd.Set("token_type", "")
+				_ = rd.Set("expires_at", "")
+				return nil
+			}
+
+			endpoint, _ := rd.Get("endpoint").(string)
+			form := url.Values{
+				"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+				"subject_token":      {subjectToken},
+				"subject_token_type": {tokenExchangeSubjects[subject][1]},
+			}
+			if audience, _ := rd.Get("audience").(string); audience != "" {
+				form.Set("audience", audience)
+			}
+			if scopes, _ := rd.Get("scopes").([]interface{}); len(scopes) > 0 {
+				values := make([]string, 0, len(scopes))
+				for _, scope := range scopes {
+					value, _ := scope.(string)
+					values = append(values, value)
+				}
+				form.Set("scope", strings.Join(values, " "))
+			}
+
+			token, err := exchangeToken(ctx, endpoint, form)
+			if err != nil {
+				return diag.Errorf("exchange token with %q: %s", endpoint, err)
+			}
+			_ = rd.Set("access_token", token.AccessToken)
+			_ = rd.Set("token_type", token.TokenType)
+			expiresAt := ""
+			if token.ExpiresIn > 0 {
+				expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+			}
+			_ = rd.Set("expires_at", expiresAt)
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"endpoint": {
+				Type:         schema.TypeString,
+				Description:  "The URL of the token exchange endpoint.",
+				Required:     true,
+				ValidateFunc: validation.IsURLWithScheme([]string{"http", "https"}),
+			},
+			"audience": {
+				Type:        schema.TypeString,
+				Description: "The audience the exchanged token is intended for, as expected by the endpoint.",
+				Optional:    true,
+			},
+			"scopes": {
+				Type:        schema.TypeList,
+				Description: "The scopes to request for the exchanged token.",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"subject_token": {
+				Type:         schema.TypeString,
+				Description:  `The identity of the workspace owner to exchange. Must be one of: "oidc_id_token" (default) or "oidc_access_token".`,
+				Optional:     true,
+				Default:      "oidc_id_token",
+				ValidateFunc: validation.StringInSlice([]string{"oidc_id_token", "oidc_access_token"}, false),
+			},
+			"access_token": {
+				Type:        schema.TypeString,
+				Description: "The exchanged token. Empty if the workspace owner didn't authenticate with OpenID Connect.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"token_type": {
+				Type:        schema.TypeString,
+				Description: `The type of "access_token" returned by the endpoint, such as "Bearer".`,
+				Computed:    true,
+			},
+			"expires_at": {
+				Type:        schema.TypeString,
+				Description: `When "access_token" expires, as an RFC 3339 timestamp. Empty if the endpoint didn't say.`,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+type tokenExchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// exchangeToken posts an RFC 8693 token exchange request to endpoint.
+func exchangeToken(ctx context.Context, endpoint string, form url.Values) (*tokenExchangeResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, identityRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, xerrors.Errorf("read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token tokenExchangeResponse
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return nil, xerrors.Errorf("decode response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, xerrors.New("response did not include an access_token")
+	}
+	return &token, nil
+}
@@ -0,0 +1,79 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/coder/terraform-provider-coder/provider"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExchange(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN", "id-token")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if r.PostForm.Get("audience") != "artifactory" {
+			http.Error(w, "unknown audience", http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "id-token", r.PostForm.Get("subject_token"))
+		assert.Equal(t, "urn:ietf:params:oauth:token-type:id_token", r.PostForm.Get("subject_token_type"))
+		assert.Equal(t, "read write", r.PostForm.Get("scope"))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "registry-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			data "coder_token_exchange" "registry" {
+				endpoint = %q
+				audience = "artifactory"
+				scopes = ["read", "write"]
+			}
+			`, srv.URL),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_token_exchange.registry"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "registry-token", attribs["access_token"])
+				require.Equal(t, "Bearer", attribs["token_type"])
+				require.NotEmpty(t, attribs["expires_at"])
+				return nil
+			},
+		}, {
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			data "coder_token_exchange" "registry" {
+				endpoint = %q
+				audience = "nexus"
+			}
+			`, srv.URL),
+			ExpectError: regexp.MustCompile("unexpected status 400: unknown audience"),
+		}},
+	})
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/xerrors"
+)
+
+// terraformVariable is an input variable declared by the template, as far as
+// it can be promoted to a parameter.
+type terraformVariable struct {
+	Type        string
+	Description string
+	// Default is the default value encoded the way parameters expect it.
+	Default    string
+	HasDefault bool
+	// Err is why the variable can't be promoted to a parameter. It's only
+	// reported for variables a parameter references, so templates can
+	// declare variables of any type.
+	Err error
+}
+
+var terraformVariableSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{
+		Type:       "variable",
+		LabelNames: []string{"name"},
+	}},
+}
+
+var terraformVariableBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "type"},
+		{Name: "description"},
+		{Name: "default"},
+	},
+}
+
+// readTerraformVariables parses the input variables declared by the ".tf" and
+// ".tf.json" files in dir. Terraform runs the provider from the template
+// directory, so this is the template's root module. Variables of other
+// modules aren't read.
+func readTerraformVariables(dir string) (map[string]terraformVariable, error) {
+	var paths []string
+	for _, pattern := range []string{"*.tf", "*.tf.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	parser := hclparse.NewParser()
+	variables := map[string]terraformVariable{}
+	for _, path := range paths {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(path, ".json") {
+			file, diags = parser.ParseJSONFile(path)
+		} else {
+			file, diags = parser.ParseHCLFile(path)
+		}
+		if diags.HasErrors() {
+			return nil, xerrors.Errorf("parse %q: %s", path, diags.Error())
+		}
+		// Everything other than variables is left to Terraform.
+		content, _, _ := file.Body.PartialContent(terraformVariableSchema)
+		for _, block := range content.Blocks {
+			variable, err := decodeTerraformVariable(file.Bytes, block)
+			if err != nil {
+				variable = terraformVariable{
+					Err: xerrors.Errorf("variable %q in %q: %w", block.Labels[0], path, err),
+				}
+			}
+			variables[block.Labels[0]] = variable
+		}
+	}
+	return variables, nil
+}
+
+func decodeTerraformVariable(src []byte, block *hcl.Block) (terraformVariable, error) {
+	content, _, diags := block.Body.PartialContent(terraformVariableBlockSchema)
+	if diags.HasErrors() {
+		return terraformVariable{}, xerrors.New(diags.Error())
+	}
+	variable := terraformVariable{
+		Type: "string",
+	}
+	if attr, ok := content.Attributes["type"]; ok {
+		// Type constraints are keywords and calls rather than values, so
+		// compare their source text. The JSON syntax has them as strings.
+		constraint := string(attr.Expr.Range().SliceBytes(src))
+		if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && !value.IsNull() {
+			constraint = value.AsString()
+		}
+		typ := strings.Join(strings.Fields(constraint), "")
+		if !slices.Contains([]string{"string", "number", "bool", "list(string)", "map(string)"}, typ) {
+			return terraformVariable{}, xerrors.Errorf("type %q can't be used for a parameter", typ)
+		}
+		variable.Type = typ
+	}
+	if attr, ok := content.Attributes["description"]; ok {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+			return terraformVariable{}, xerrors.New("description must be a string")
+		}
+		variable.Description = value.AsString()
+	}
+	if attr, ok := content.Attributes["default"]; ok {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return terraformVariable{}, xerrors.Errorf("default: %s", diags.Error())
+		}
+		if !value.IsNull() {
+			encoded, err := encodeVariableDefault(value)
+			if err != nil {
+				return terraformVariable{}, xerrors.Errorf("default: %w", err)
+			}
+			variable.Default = encoded
+			variable.HasDefault = true
+		}
+	}
+	return variable, nil
+}
+
+// encodeVariableDefault converts a default value to the string form used by
+// parameter values. Lists are JSON encoded.
+func encodeVariableDefault(value cty.Value) (string, error) {
+	switch {
+	case value.Type() == cty.String:
+		return value.AsString(), nil
+	case value.Type() == cty.Number:
+		return value.AsBigFloat().Text('f', -1), nil
+	case value.Type() == cty.Bool:
+		if value.True() {
+			return "true", nil
+		}
+		return "false", nil
+	case value.Type().IsTupleType() || value.Type().IsListType():
+		items := []string{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			if item.Type() != cty.String || item.IsNull() {
+				return "", xerrors.New("list items must be strings")
+			}
+			items = append(items, item.AsString())
+		}
+		data, err := json.Marshal(items)
+		return string(data), err
+	case value.Type().IsObjectType() || value.Type().IsMapType():
+		items := map[string]string{}
+		for it := value.ElementIterator(); it.Next(); {
+			key, item := it.Element()
+			if item.Type() != cty.String || item.IsNull() {
+				return "", xerrors.New("map values must be strings")
+			}
+			items[key.AsString()] = item.AsString()
+		}
+		data, err := json.Marshal(items)
+		return string(data), err
+	default:
+		return "", xerrors.Errorf("unsupported type %s", value.Type().FriendlyName())
+	}
+}
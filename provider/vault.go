@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/xerrors"
+)
+
+func vaultTokenDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description: "Use this data source to log in to HashiCorp Vault with the JWT/OIDC auth method using the " +
+			"workspace owner's OpenID Connect ID token. The resulting short-lived token can be passed to the " +
+			"Vault provider or into the workspace to fetch per-user secrets without embedding Vault credentials.",
+		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			rd.SetId(uuid.NewString())
+
+			idToken := config.Env.Get("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN")
+			if idToken == "" {
+				// The owner didn't authenticate with OpenID Connect, or the
+				// template is being imported without a workspace.
+				_ = rd.Set("token", "")
+				_ = rd.Set("accessor", "")
+				_ = rd.Set("policies", []string{})
+				_ = rd.Set("expires_at", "")
+				return nil
+			}
+
+			address, _ := rd.Get("address").(string)
+			mount, _ := rd.Get("mount").(string)
+			role, _ := rd.Get("role").(string)
+			namespace, _ := rd.Get("namespace").(string)
+			auth, err := vaultJWTLogin(ctx, address, namespace, mount, role, idToken)
+			if err != nil {
+				return diag.Errorf("log in to vault at %q: %s", address, err)
+			}
+			_ = rd.Set("token", auth.ClientToken)
+			_ = rd.Set("accessor", auth.Accessor)
+			_ = rd.Set("policies", auth.Policies)
+			expiresAt := ""
+			if auth.LeaseDuration > 0 {
+				expiresAt = time.Now().Add(time.Duration(auth.LeaseDuration) * time.Second).UTC().Format(time.RFC3339)
+			}
+			_ = rd.Set("expires_at", expiresAt)
+			return nil
+		},
+		Schema: map[string]*schema.Schema{
+			"address": {
+				Type:         schema.TypeString,
+				Description:  `The address of the Vault server, such as "https://vault.example.com:8200".`,
+				Required:     true,
+				ValidateFunc: validation.IsURLWithScheme([]string{"http", "https"}),
+			},
+			"role": {
+				Type:        schema.TypeString,
+				Description: "The name of the JWT/OIDC auth method role to log in with.",
+				Required:    true,
+			},
+			"mount": {
+				Type:        schema.TypeString,
+				Description: "The path the JWT/OIDC auth method is mounted at.",
+				Optional:    true,
+				Default:     "jwt",
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Description: "The Vault Enterprise namespace to log in to.",
+				Optional:    true,
+			},
+			"token": {
+				Type:        schema.TypeString,
+				Description: "The Vault token. Empty if the workspace owner didn't authenticate with OpenID Connect.",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"accessor": {
+				Type:        schema.TypeString,
+				Description: `The accessor of "token", which can be used to look up or revoke it without knowing the token.`,
+				Computed:    true,
+			},
+			"policies": {
+				Type:        schema.TypeList,
+				Description: `The policies attached to "token".`,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"expires_at": {
+				Type:        schema.TypeString,
+				Description: `When "token" expires, as an RFC 3339 timestamp. Empty if the token doesn't expire.`,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+type vaultAuth struct {
+	ClientToken   string   `json:"client_token"`
+	Accessor      string   `json:"accessor"`
+	Policies      []string `json:"policies"`
+	LeaseDuration int64    `json:"lease_duration"`
+}
+
+// vaultJWTLogin logs in to the JWT/OIDC auth method mounted at mount.
+func vaultJWTLogin(ctx context.Context, address, namespace, mount, role, jwt string) (*vaultAuth, error) {
+	ctx, cancel := context.WithTimeout(ctx, identityRequestTimeout)
+	defer cancel()
+	payload, err := json.Marshal(map[string]string{
+		"role": role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encode request: %w", err)
+	}
+	endpoint := strings.TrimSuffix(address, "/") + "/v1/auth/" + strings.Trim(mount, "/") + "/login"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, xerrors.Errorf("read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var login struct {
+		Auth *vaultAuth `json:"auth"`
+	}
+	err = json.Unmarshal(body, &login)
+	if err != nil {
+		return nil, xerrors.Errorf("decode response: %w", err)
+	}
+	if login.Auth == nil || login.Auth.ClientToken == "" {
+		return nil, xerrors.New("response did not include a client token")
+	}
+	return login.Auth, nil
+}
@@ -0,0 +1,86 @@
+package provider_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/coder/terraform-provider-coder/provider"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultToken(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN", "id-token")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/auth/oidc/login", r.URL.Path)
+		assert.Equal(t, "engineering", r.Header.Get("X-Vault-Namespace"))
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "id-token", req["jwt"])
+		if req["role"] != "workspace" {
+			http.Error(w, `{"errors":["role not found"]}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   "hvs.token",
+				"accessor":       "accessor",
+				"policies":       []string{"default", "workspace"},
+				"lease_duration": 900,
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			data "coder_vault_token" "me" {
+				address = %q
+				mount = "oidc"
+				role = "workspace"
+				namespace = "engineering"
+			}
+			`, srv.URL),
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				require.Len(t, state.Modules[0].Resources, 1)
+				resource := state.Modules[0].Resources["data.coder_vault_token.me"]
+				require.NotNil(t, resource)
+
+				attribs := resource.Primary.Attributes
+				require.Equal(t, "hvs.token", attribs["token"])
+				require.Equal(t, "accessor", attribs["accessor"])
+				require.Equal(t, "workspace", attribs["policies.1"])
+				require.NotEmpty(t, attribs["expires_at"])
+				return nil
+			},
+		}, {
+			Config: fmt.Sprintf(`
+			provider "coder" {
+			}
+			data "coder_vault_token" "me" {
+				address = %q
+				mount = "oidc"
+				role = "missing"
+				namespace = "engineering"
+			}
+			`, srv.URL),
+			ExpectError: regexp.MustCompile("role not found"),
+		}},
+	})
+}
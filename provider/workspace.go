@@ -3,20 +3,26 @@ package provider
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/xerrors"
 )
 
 func workspaceDataSource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this data source to get information for the active workspace build.",
 		ReadContext: func(c context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
-			transition := os.Getenv("CODER_WORKSPACE_TRANSITION")
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			transition := config.Env.Get("CODER_WORKSPACE_TRANSITION")
 			if transition == "" {
 				// Default to start!
 				transition = "start"
@@ -27,20 +33,35 @@ func workspaceDataSource() *schema.Resource {
 				count = 1
 			}
 			_ = rd.Set("start_count", count)
+			_ = rd.Set("previous_transition", config.Env.Get("CODER_WORKSPACE_PREVIOUS_TRANSITION"))
+			_ = rd.Set("previous_build_status", config.Env.Get("CODER_WORKSPACE_PREVIOUS_BUILD_STATUS"))
 
-			owner := os.Getenv("CODER_WORKSPACE_OWNER")
+			// A prebuilt workspace is built before anyone asks for it, then
+			// rebuilt once when a user claims it.
+			isPrebuild := config.Env.Get("CODER_WORKSPACE_IS_PREBUILD") == "true"
+			isPrebuildClaim := config.Env.Get("CODER_WORKSPACE_IS_PREBUILD_CLAIM") == "true"
+			if isPrebuild && isPrebuildClaim {
+				return diag.Errorf("a workspace build can't both create a prebuild and claim it")
+			}
+			if isPrebuild && transition != "start" {
+				return diag.Errorf("prebuilds can only be started, not %q", transition)
+			}
+			_ = rd.Set("is_prebuild", isPrebuild)
+			_ = rd.Set("is_prebuild_claim", isPrebuildClaim)
+
+			owner := config.Env.Get("CODER_WORKSPACE_OWNER")
 			if owner == "" {
 				owner = "default"
 			}
 			_ = rd.Set("owner", owner)
 
-			ownerEmail := os.Getenv("CODER_WORKSPACE_OWNER_EMAIL")
+			ownerEmail := config.Env.Get("CODER_WORKSPACE_OWNER_EMAIL")
 			if ownerEmail == "" {
 				ownerEmail = "default@example.com"
 			}
 			_ = rd.Set("owner_email", ownerEmail)
 
-			ownerGroupsText := os.Getenv("CODER_WORKSPACE_OWNER_GROUPS")
+			ownerGroupsText := config.Env.Get("CODER_WORKSPACE_OWNER_GROUPS")
 			var ownerGroups []string
 			if ownerGroupsText != "" {
 				err := json.Unmarshal([]byte(ownerGroupsText), &ownerGroups)
@@ -50,49 +71,76 @@ func workspaceDataSource() *schema.Resource {
 			}
 			_ = rd.Set("owner_groups", ownerGroups)
 
-			ownerName := os.Getenv("CODER_WORKSPACE_OWNER_NAME")
+			ownerName := config.Env.Get("CODER_WORKSPACE_OWNER_NAME")
 			if ownerName == "" {
 				ownerName = "default"
 			}
 			_ = rd.Set("owner_name", ownerName)
 
-			ownerID := os.Getenv("CODER_WORKSPACE_OWNER_ID")
+			ownerID := config.Env.Get("CODER_WORKSPACE_OWNER_ID")
 			if ownerID == "" {
 				ownerID = uuid.Nil.String()
 			}
 			_ = rd.Set("owner_id", ownerID)
 
-			ownerOIDCAccessToken := os.Getenv("CODER_WORKSPACE_OWNER_OIDC_ACCESS_TOKEN")
+			ownerOIDCAccessToken := config.Env.Get("CODER_WORKSPACE_OWNER_OIDC_ACCESS_TOKEN")
 			_ = rd.Set("owner_oidc_access_token", ownerOIDCAccessToken)
 
-			name := os.Getenv("CODER_WORKSPACE_NAME")
+			name := config.Env.Get("CODER_WORKSPACE_NAME")
 			if name == "" {
 				name = "default"
 			}
 			rd.Set("name", name)
 
-			sessionToken := os.Getenv("CODER_WORKSPACE_OWNER_SESSION_TOKEN")
+			sessionToken := config.Env.Get("CODER_WORKSPACE_OWNER_SESSION_TOKEN")
 			_ = rd.Set("owner_session_token", sessionToken)
 
-			id := os.Getenv("CODER_WORKSPACE_ID")
-			if id == "" {
-				id = uuid.NewString()
-			}
-			rd.SetId(id)
+			rd.SetId(workspaceID(config.Env))
 
-			templateID := os.Getenv("CODER_WORKSPACE_TEMPLATE_ID")
+			templateID := config.Env.Get("CODER_WORKSPACE_TEMPLATE_ID")
 			_ = rd.Set("template_id", templateID)
 
-			templateName := os.Getenv("CODER_WORKSPACE_TEMPLATE_NAME")
+			templateName := config.Env.Get("CODER_WORKSPACE_TEMPLATE_NAME")
 			_ = rd.Set("template_name", templateName)
 
-			templateVersion := os.Getenv("CODER_WORKSPACE_TEMPLATE_VERSION")
+			templateVersion := config.Env.Get("CODER_WORKSPACE_TEMPLATE_VERSION")
 			_ = rd.Set("template_version", templateVersion)
 
-			config, valid := i.(config)
-			if !valid {
-				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			automaticUpdates := config.Env.Get("CODER_WORKSPACE_AUTOMATIC_UPDATES")
+			if automaticUpdates == "" {
+				automaticUpdates = "never"
+			}
+			_ = rd.Set("automatic_updates", automaticUpdates)
+
+			deadline := config.Env.Get("CODER_WORKSPACE_BUILD_DEADLINE")
+			if deadline != "" {
+				if _, err := time.Parse(time.RFC3339, deadline); err != nil {
+					return diag.Errorf("couldn't parse build deadline %q: %s", deadline, err)
+				}
+			}
+			_ = rd.Set("deadline", deadline)
+
+			maxTTL := 0
+			if rawMaxTTL := config.Env.Get("CODER_WORKSPACE_TEMPLATE_MAX_TTL"); rawMaxTTL != "" {
+				var err error
+				maxTTL, err = strconv.Atoi(rawMaxTTL)
+				if err != nil || maxTTL < 0 {
+					return diag.Errorf("couldn't parse template max TTL %q, must be a number of seconds", rawMaxTTL)
+				}
 			}
+			_ = rd.Set("max_ttl", maxTTL)
+
+			sharedUsers, err := workspaceShares(config.Env, "CODER_WORKSPACE_SHARED_USERS", "username")
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			_ = rd.Set("shared_users", sharedUsers)
+			sharedGroups, err := workspaceShares(config.Env, "CODER_WORKSPACE_SHARED_GROUPS", "name")
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			_ = rd.Set("shared_groups", sharedGroups)
+
 			rd.Set("access_url", config.URL.String())
 
 			rawPort := config.URL.Port()
@@ -108,6 +156,10 @@ func workspaceDataSource() *schema.Resource {
 			}
 			rd.Set("access_port", port)
 
+			workspaceURL := config.URL.JoinPath("@"+owner, name).String()
+			rd.Set("url", workspaceURL)
+			rd.Set("app_url_template", workspaceURL+".{agent}/apps/{app}/")
+
 			return nil
 		},
 		Schema: map[string]*schema.Schema{
@@ -121,6 +173,18 @@ func workspaceDataSource() *schema.Resource {
 				Computed:    true,
 				Description: "The access port of the Coder deployment provisioning this workspace.",
 			},
+			"url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The URL of the workspace page in the dashboard, including any path prefix of the access URL.",
+			},
+			"app_url_template": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The path-based URL of an app in this workspace, with the placeholders `{agent}` and `{app}` " +
+					"for the agent name and app slug. Use `replace()` to fill them in, for example " +
+					"`replace(replace(data.coder_workspace.me.app_url_template, \"{agent}\", \"main\"), \"{app}\", \"code-server\")`.",
+			},
 			"start_count": {
 				Type:        schema.TypeInt,
 				Computed:    true,
@@ -131,6 +195,18 @@ func workspaceDataSource() *schema.Resource {
 				Computed:    true,
 				Description: `Either "start" or "stop". Use this to start/stop resources with "count".`,
 			},
+			"previous_transition": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: `The transition of the previous build of the workspace: "start", "stop" or "delete". Empty for the first build.`,
+			},
+			"previous_build_status": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: `The status of the previous build of the workspace, such as "succeeded", "failed" or "canceled". ` +
+					`Empty for the first build. Use this to detect a restart after a failed build, for example to clean up ` +
+					`or skip steps that already completed.`,
+			},
 			"owner": {
 				Type:        schema.TypeString,
 				Computed:    true,
@@ -203,6 +279,128 @@ func workspaceDataSource() *schema.Resource {
 				Computed:    true,
 				Description: "Version of the workspace's template.",
 			},
+			"deadline": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "When the workspace will stop automatically, as an RFC 3339 timestamp. Empty if it doesn't stop " +
+					"automatically. Use this to tell users when the workspace stops, or to warn them before it does.",
+			},
+			"max_ttl": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The maximum number of seconds the template allows workspaces to run for before they stop. 0 if there's no limit.",
+			},
+			"is_prebuild": {
+				Type:     schema.TypeBool,
+				Computed: true,
+				Description: "Whether the build creates a prebuilt workspace, which isn't owned by a user yet. Use this to skip " +
+					"per-user setup, such as cloning the owner's repositories, until the workspace is claimed.",
+			},
+			"is_prebuild_claim": {
+				Type:     schema.TypeBool,
+				Computed: true,
+				Description: "Whether the build hands a prebuilt workspace over to the user claiming it. Use this to run " +
+					"the per-user setup skipped while it was prebuilt. Resources shouldn't depend on it, or they'll be " +
+					"replaced when the workspace is claimed.",
+			},
+			"automatic_updates": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: `Whether the workspace updates to the active version of its template when it starts: "always" or "never". ` +
+					`Use this to align the template with it, for example to track the latest image tag only when the ` +
+					`workspace updates automatically. Defaults to "never".`,
+			},
+			"shared_users": {
+				Type: schema.TypeList,
+				Description: "The users the workspace is shared with, besides its owner. Use this to grant them " +
+					"matching access in other systems, such as a role in a database the workspace provisions.",
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Description: "UUID of the user.",
+							Computed:    true,
+						},
+						"username": {
+							Type:        schema.TypeString,
+							Description: "Username of the user.",
+							Computed:    true,
+						},
+						"role": {
+							Type:        schema.TypeString,
+							Description: `The role of the user in the workspace, such as "use" or "admin".`,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"shared_groups": {
+				Type:        schema.TypeList,
+				Description: "The groups the workspace is shared with. Their members have the role of the group, unless shared with them directly.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Description: "UUID of the group.",
+							Computed:    true,
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Description: "Name of the group.",
+							Computed:    true,
+						},
+						"role": {
+							Type:        schema.TypeString,
+							Description: `The role of the group's members in the workspace, such as "use" or "admin".`,
+							Computed:    true,
+						},
+					},
+				},
+			},
 		},
 	}
 }
+
+// workspaceShares parses the users or groups the workspace is shared with
+// from the JSON array in the environment variable key, such as
+// [{"id":"...","username":"alice","role":"use"}]. nameKey is the key of their
+// name.
+func workspaceShares(env environment, key, nameKey string) ([]map[string]interface{}, error) {
+	raw := env.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	var shares []map[string]string
+	if err := json.Unmarshal([]byte(raw), &shares); err != nil {
+		return nil, xerrors.Errorf("couldn't parse %s %q: %w", key, raw, err)
+	}
+	values := make([]map[string]interface{}, 0, len(shares))
+	for _, share := range shares {
+		values = append(values, map[string]interface{}{
+			"id":    share["id"],
+			nameKey: share[nameKey],
+			"role":  share["role"],
+		})
+	}
+	return values, nil
+}
+
+// workspaceID returns the ID of the workspace being built. Outside of a
+// build, such as when importing a template, it's derived from the owner and
+// workspace name defaults.
+func workspaceID(env environment) string {
+	if id := env.Get("CODER_WORKSPACE_ID"); id != "" {
+		return id
+	}
+	owner := env.Get("CODER_WORKSPACE_OWNER")
+	if owner == "" {
+		owner = "default"
+	}
+	name := env.Get("CODER_WORKSPACE_NAME")
+	if name == "" {
+		name = "default"
+	}
+	return deterministicID("workspace", owner, name)
+}
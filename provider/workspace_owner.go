@@ -1,59 +1,91 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
-	"os"
+	"fmt"
+	"reflect"
 	"strings"
 
-	"github.com/google/uuid"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/xerrors"
 )
 
 func workspaceOwnerDataSource() *schema.Resource {
 	return &schema.Resource{
 		Description: "Use this data source to fetch information about the workspace owner.",
 		ReadContext: func(ctx context.Context, rd *schema.ResourceData, i interface{}) diag.Diagnostics {
-			if idStr := os.Getenv("CODER_WORKSPACE_OWNER_ID"); idStr != "" {
+			config, valid := i.(config)
+			if !valid {
+				return diag.Errorf("config was unexpected type %q", reflect.TypeOf(i).String())
+			}
+
+			if idStr := config.Env.Get("CODER_WORKSPACE_OWNER_ID"); idStr != "" {
 				rd.SetId(idStr)
 			} else {
-				rd.SetId(uuid.NewString())
+				rd.SetId(deterministicID("workspace_owner", config.Env.Get("CODER_WORKSPACE_OWNER"), config.Env.Get("CODER_WORKSPACE_OWNER_EMAIL")))
 			}
 
-			if username := os.Getenv("CODER_WORKSPACE_OWNER"); username != "" {
+			if username := config.Env.Get("CODER_WORKSPACE_OWNER"); username != "" {
 				_ = rd.Set("name", username)
 			} else {
 				_ = rd.Set("name", "default")
 			}
 
-			if fullname := os.Getenv("CODER_WORKSPACE_OWNER_NAME"); fullname != "" {
+			if fullname := config.Env.Get("CODER_WORKSPACE_OWNER_NAME"); fullname != "" {
 				_ = rd.Set("full_name", fullname)
 			} else { // compat: field can be blank, fill in default
 				_ = rd.Set("full_name", "default")
 			}
 
-			if email := os.Getenv("CODER_WORKSPACE_OWNER_EMAIL"); email != "" {
+			if email := config.Env.Get("CODER_WORKSPACE_OWNER_EMAIL"); email != "" {
 				_ = rd.Set("email", email)
 			} else {
 				_ = rd.Set("email", "default@example.com")
 			}
 
-			_ = rd.Set("ssh_public_key", os.Getenv("CODER_WORKSPACE_OWNER_SSH_PUBLIC_KEY"))
-			_ = rd.Set("ssh_private_key", os.Getenv("CODER_WORKSPACE_OWNER_SSH_PRIVATE_KEY"))
+			_ = rd.Set("ssh_public_key", config.Env.Get("CODER_WORKSPACE_OWNER_SSH_PUBLIC_KEY"))
+			_ = rd.Set("ssh_private_key", config.Env.Get("CODER_WORKSPACE_OWNER_SSH_PRIVATE_KEY"))
+			_ = rd.Set("avatar_url", config.Env.Get("CODER_WORKSPACE_OWNER_AVATAR_URL"))
+			_ = rd.Set("theme_preference", config.Env.Get("CODER_WORKSPACE_OWNER_THEME_PREFERENCE"))
 
 			var groups []string
-			if groupsRaw, ok := os.LookupEnv("CODER_WORKSPACE_OWNER_GROUPS"); ok {
+			if groupsRaw, ok := config.Env.Lookup("CODER_WORKSPACE_OWNER_GROUPS"); ok {
 				if err := json.NewDecoder(strings.NewReader(groupsRaw)).Decode(&groups); err != nil {
 					return diag.Errorf("invalid user groups: %s", err.Error())
 				}
 			}
 			_ = rd.Set("groups", groups)
 
-			_ = rd.Set("session_token", os.Getenv("CODER_WORKSPACE_OWNER_SESSION_TOKEN"))
-			_ = rd.Set("oidc_access_token", os.Getenv("CODER_WORKSPACE_OWNER_OIDC_ACCESS_TOKEN"))
+			_ = rd.Set("session_token", config.Env.Get("CODER_WORKSPACE_OWNER_SESSION_TOKEN"))
+			_ = rd.Set("oidc_access_token", config.Env.Get("CODER_WORKSPACE_OWNER_OIDC_ACCESS_TOKEN"))
+
+			idToken := config.Env.Get("CODER_WORKSPACE_OWNER_OIDC_ID_TOKEN")
+			_ = rd.Set("oidc_id_token", idToken)
+			claims := map[string]string{}
+			var diags diag.Diagnostics
+			if idToken != "" {
+				// The token comes from the identity provider, so a token that
+				// can't be decoded shouldn't break every workspace build.
+				decoded, err := idTokenClaims(idToken)
+				if err != nil {
+					diags = append(diags, diag.Diagnostic{
+						Severity:      diag.Warning,
+						Summary:       "Invalid OIDC ID token",
+						Detail:        fmt.Sprintf("The claims of the OIDC ID token can't be decoded, so \"oidc_claims\" is empty: %s", err),
+						AttributePath: cty.GetAttrPath("oidc_claims"),
+					})
+				} else {
+					claims = decoded
+				}
+			}
+			_ = rd.Set("oidc_claims", claims)
 
-			return nil
+			return diags
 		},
 		Schema: map[string]*schema.Schema{
 			"id": {
@@ -76,6 +108,16 @@ func workspaceOwnerDataSource() *schema.Resource {
 				Computed:    true,
 				Description: "The email address of the user.",
 			},
+			"avatar_url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The URL of the user's avatar. Empty if the user hasn't set one.",
+			},
+			"theme_preference": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The user's preferred dashboard theme, such as \"dark\" or \"light\". Empty if the user follows their system theme.",
+			},
 			"ssh_public_key": {
 				Type:        schema.TypeString,
 				Computed:    true,
@@ -107,6 +149,57 @@ func workspaceOwnerDataSource() *schema.Resource {
 					"This is only available if the workspace owner authenticated with OpenID Connect. " +
 					"If a valid token cannot be obtained, this value will be an empty string.",
 			},
+			"oidc_id_token": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+				Description: "The OpenID Connect ID token of the workspace owner, for systems that require " +
+					"identity assertions such as AWS or GCP workload identity federation. " +
+					"This is only available if the workspace owner authenticated with OpenID Connect.",
+			},
+			"oidc_claims": {
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed:  true,
+				Sensitive: true,
+				Description: "The claims of \"oidc_id_token\". Claims that aren't strings are JSON encoded. " +
+					"The token signature is not verified, so don't rely on these for authorization. Empty if the " +
+					"token can't be decoded.",
+			},
 		},
 	}
 }
+
+// idTokenClaims decodes the payload of a JWT without verifying it.
+func idTokenClaims(token string) (map[string]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, xerrors.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, xerrors.Errorf("decode payload: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	err = decoder.Decode(&raw)
+	if err != nil {
+		return nil, xerrors.Errorf("decode claims: %w", err)
+	}
+	claims := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if str, ok := value.(string); ok {
+			claims[name] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, xerrors.Errorf("encode claim %q: %w", name, err)
+		}
+		claims[name] = string(encoded)
+	}
+	return claims, nil
+}
@@ -1,6 +1,7 @@
 package provider_test
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
@@ -23,6 +24,13 @@ func TestWorkspace(t *testing.T) {
 	t.Setenv("CODER_WORKSPACE_TEMPLATE_ID", "templateID")
 	t.Setenv("CODER_WORKSPACE_TEMPLATE_NAME", "template123")
 	t.Setenv("CODER_WORKSPACE_TEMPLATE_VERSION", "v1.2.3")
+	t.Setenv("CODER_WORKSPACE_AUTOMATIC_UPDATES", "always")
+	t.Setenv("CODER_WORKSPACE_BUILD_DEADLINE", "2030-01-01T18:00:00Z")
+	t.Setenv("CODER_WORKSPACE_TEMPLATE_MAX_TTL", "86400")
+	t.Setenv("CODER_WORKSPACE_PREVIOUS_TRANSITION", "start")
+	t.Setenv("CODER_WORKSPACE_PREVIOUS_BUILD_STATUS", "failed")
+	t.Setenv("CODER_WORKSPACE_SHARED_USERS", `[{"id":"22222222-2222-2222-2222-222222222222","username":"alice","role":"admin"}]`)
+	t.Setenv("CODER_WORKSPACE_SHARED_GROUPS", `[{"id":"33333333-3333-3333-3333-333333333333","name":"platform","role":"use"}]`)
 
 	resource.Test(t, resource.TestCase{
 		Providers: map[string]*schema.Provider{
@@ -48,6 +56,8 @@ func TestWorkspace(t *testing.T) {
 				t.Log(value)
 				assert.Equal(t, "https://example.com:8080", attribs["access_url"])
 				assert.Equal(t, "8080", attribs["access_port"])
+				assert.Equal(t, "https://example.com:8080/@owner123/default", attribs["url"])
+				assert.Equal(t, "https://example.com:8080/@owner123/default.{agent}/apps/{app}/", attribs["app_url_template"])
 				assert.Equal(t, "owner123", attribs["owner"])
 				assert.Equal(t, "11111111-1111-1111-1111-111111111111", attribs["owner_id"])
 				assert.Equal(t, "Mr Owner", attribs["owner_name"])
@@ -58,12 +68,59 @@ func TestWorkspace(t *testing.T) {
 				assert.Equal(t, "template123", attribs["template_name"])
 				assert.Equal(t, "v1.2.3", attribs["template_version"])
 				assert.Equal(t, "supersecret", attribs["owner_oidc_access_token"])
+				assert.Equal(t, "always", attribs["automatic_updates"])
+				assert.Equal(t, "2030-01-01T18:00:00Z", attribs["deadline"])
+				assert.Equal(t, "86400", attribs["max_ttl"])
+				assert.Equal(t, "start", attribs["previous_transition"])
+				assert.Equal(t, "failed", attribs["previous_build_status"])
+				assert.Equal(t, "1", attribs["shared_users.#"])
+				assert.Equal(t, "22222222-2222-2222-2222-222222222222", attribs["shared_users.0.id"])
+				assert.Equal(t, "alice", attribs["shared_users.0.username"])
+				assert.Equal(t, "admin", attribs["shared_users.0.role"])
+				assert.Equal(t, "1", attribs["shared_groups.#"])
+				assert.Equal(t, "33333333-3333-3333-3333-333333333333", attribs["shared_groups.0.id"])
+				assert.Equal(t, "platform", attribs["shared_groups.0.name"])
+				assert.Equal(t, "use", attribs["shared_groups.0.role"])
 				return nil
 			},
 		}},
 	})
 }
 
+func TestWorkspacePrebuild(t *testing.T) {
+	t.Setenv("CODER_WORKSPACE_IS_PREBUILD_CLAIM", "true")
+
+	resource.Test(t, resource.TestCase{
+		Providers: map[string]*schema.Provider{
+			"coder": provider.New(),
+		},
+		IsUnitTest: true,
+		Steps: []resource.TestStep{{
+			Config: `
+			provider "coder" {}
+			data "coder_workspace" "me" {
+			}`,
+			Check: func(state *terraform.State) error {
+				require.Len(t, state.Modules, 1)
+				resource := state.Modules[0].Resources["data.coder_workspace.me"]
+				require.NotNil(t, resource)
+				assert.Equal(t, "false", resource.Primary.Attributes["is_prebuild"])
+				assert.Equal(t, "true", resource.Primary.Attributes["is_prebuild_claim"])
+				return nil
+			},
+		}, {
+			PreConfig: func() {
+				t.Setenv("CODER_WORKSPACE_IS_PREBUILD", "true")
+			},
+			Config: `
+			provider "coder" {}
+			data "coder_workspace" "me" {
+			}`,
+			ExpectError: regexp.MustCompile("can't both create a prebuild and claim it"),
+		}},
+	})
+}
+
 func TestWorkspace_UndefinedOwner(t *testing.T) {
 	t.Setenv("CODER_WORKSPACE_OWNER", "owner123")
 	t.Setenv("CODER_WORKSPACE_OWNER_SESSION_TOKEN", "abc123")
@@ -96,6 +153,11 @@ func TestWorkspace_UndefinedOwner(t *testing.T) {
 				t.Log(value)
 				assert.Equal(t, "owner123", attribs["owner"])
 				assert.Equal(t, "default@example.com", attribs["owner_email"])
+				assert.Equal(t, "never", attribs["automatic_updates"])
+				assert.Equal(t, "false", attribs["is_prebuild"])
+				assert.Equal(t, "false", attribs["is_prebuild_claim"])
+				assert.Empty(t, attribs["deadline"])
+				assert.Equal(t, "0", attribs["max_ttl"])
 				// Skip other asserts
 				return nil
 			},